@@ -4,11 +4,20 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"github.com/chi2l3s/cloudstrike/internal/api"
+	"github.com/chi2l3s/cloudstrike/internal/audit"
+	"github.com/chi2l3s/cloudstrike/internal/auth"
 	"github.com/chi2l3s/cloudstrike/internal/config"
+	"github.com/chi2l3s/cloudstrike/internal/cvars"
 	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/presets"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+	"github.com/chi2l3s/cloudstrike/internal/rotation"
+	"github.com/chi2l3s/cloudstrike/internal/uploads"
+	"github.com/chi2l3s/cloudstrike/internal/workshop"
 )
 
 func main() {
@@ -19,6 +28,55 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if cfg.ExtraCvarPrefixes != nil {
+		cvars.Default.SetExtraPrefixes(cfg.ExtraCvarPrefixes)
+	}
+
+	authStore, err := auth.Load(cfg.AuthFile)
+	if err != nil {
+		log.Fatalf("Failed to load auth: %v", err)
+	}
+
+	uploadStore, err := uploads.NewStore(filepath.Join(cfg.DataDir, "uploads"), cfg.UploadTTL)
+	if err != nil {
+		log.Fatalf("Failed to open upload directory: %v", err)
+	}
+
+	revisionStore, err := revisions.NewStore(filepath.Join(cfg.DataDir, "revisions"), cfg.RevisionsMax)
+	if err != nil {
+		log.Fatalf("Failed to open revision directory: %v", err)
+	}
+
+	workshopStore, err := workshop.NewStore(filepath.Join(cfg.DataDir, "workshop"))
+	if err != nil {
+		log.Fatalf("Failed to open workshop directory: %v", err)
+	}
+
+	presetStore, err := presets.NewStore(filepath.Join(cfg.DataDir, "presets"))
+	if err != nil {
+		log.Fatalf("Failed to open preset directory: %v", err)
+	}
+
+	rotationStore, err := rotation.NewStore(filepath.Join(cfg.DataDir, "rotation"))
+	if err != nil {
+		log.Fatalf("Failed to open map rotation directory: %v", err)
+	}
+
+	var workshopSource workshop.MetadataSource = workshop.NewSteamSource(cfg.WorkshopAPIURL)
+	if cfg.WorkshopMock != "" {
+		mock, err := workshop.LoadMockSource(cfg.WorkshopMock)
+		if err != nil {
+			log.Fatalf("Failed to load workshop mock: %v", err)
+		}
+		workshopSource = mock
+		log.Printf("Using workshop metadata from %s", cfg.WorkshopMock)
+	}
+
+	auditLog, err := audit.Open(cfg.AuditLog)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+
 	dockerClient, err := docker.NewClient()
 	if err != nil {
 		log.Fatalf("Failed to connect to Docker: %v", err)
@@ -27,7 +85,7 @@ func main() {
 
 	log.Println("✅ Connected to Docker")
 
-	server := api.NewServer(cfg, dockerClient)
+	server := api.NewServer(cfg, dockerClient, authStore, uploadStore, revisionStore, workshopStore, workshopSource, presetStore, rotationStore, auditLog)
 	go func() {
 		if err := server.Run(); err != nil {
 			log.Fatalf("Server error: %v", err)
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/chi2l3s/cloudstrike/internal/auth"
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// requestToken returns the API token from the Authorization header, falling
+// back to the token query parameter since browsers can't set headers on
+// WebSocket handshakes.
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// requirePermission only lets the request through if its token belongs to a
+// user holding perm for the server named by the {id} path value.
+func (s *Server) requirePermission(perm auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := s.auth.Authenticate(requestToken(r))
+		if !ok {
+			s.json(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			return
+		}
+
+		fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+		if err != nil || fullID == "" {
+			s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+			return
+		}
+
+		if !s.userCan(w, user, perm, fullID) {
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}
+}
+
+// checkPermission is requirePermission for parts of a handler, such as an
+// option that needs more rights than the route. It writes the error
+// response when the request may not go on.
+func (s *Server) checkPermission(w http.ResponseWriter, r *http.Request, perm auth.Permission, fullID string) bool {
+	user, ok := s.auth.Authenticate(requestToken(r))
+	if !ok {
+		s.json(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+		return false
+	}
+	return s.userCan(w, user, perm, fullID)
+}
+
+func (s *Server) userCan(w http.ResponseWriter, user *auth.User, perm auth.Permission, fullID string) bool {
+	labels, err := s.docker.ContainerLabels(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return false
+	}
+	if !user.Can(perm, fullID, docker.ServerID(fullID, labels)) {
+		s.json(w, http.StatusForbidden, map[string]string{"error": "permission denied"})
+		return false
+	}
+	return true
+}
+
+func userFromContext(ctx context.Context) (*auth.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*auth.User)
+	return user, ok
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/jobs"
+)
+
+const maxBulkConcurrency = 16
+
+// BulkRequest selects servers by ID prefix and/or tags (a server must carry
+// every listed tag) and applies one action to each of them.
+type BulkRequest struct {
+	Action      string          `json:"action"`
+	IDs         []string        `json:"ids"`
+	Tags        []string        `json:"tags"`
+	Settings    json.RawMessage `json:"settings"`
+	Stop        StopRequest     `json:"stop"`
+	Concurrency int             `json:"concurrency"`
+	// DeleteData also removes the data volumes and stored configuration of
+	// deleted servers.
+	DeleteData bool `json:"deleteData"`
+}
+
+// BulkResult is the outcome for one server. Servers listed in ids but left
+// out by the tags are "skipped", with the reason.
+type BulkResult struct {
+	ID     string    `json:"id"`
+	Name   string    `json:"name,omitempty"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Job    *jobs.Job `json:"job,omitempty"`
+}
+
+type BulkResponse struct {
+	Action    string       `json:"action"`
+	Total     int          `json:"total"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Skipped   int          `json:"skipped"`
+	Results   []BulkResult `json:"results"`
+}
+
+func (s *Server) handleBulk(w http.ResponseWriter, r *http.Request) {
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+
+	switch req.Action {
+	case "start", "stop", "restart", "delete":
+	case "settings":
+		if len(req.Settings) == 0 {
+			s.json(w, http.StatusBadRequest, map[string]string{"error": "settings patch required"})
+			return
+		}
+	default:
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "action must be one of start, stop, restart, delete, settings"})
+		return
+	}
+
+	if len(req.IDs) == 0 && len(req.Tags) == 0 {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "ids or tags required"})
+		return
+	}
+
+	containers, err := s.docker.ListContainers()
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	targets, results := selectBulkTargets(containers, req.IDs, req.Tags)
+	author := s.requestAuthor(r)
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = s.cfg.BulkConcurrency
+	}
+	concurrency = min(max(concurrency, 1), maxBulkConcurrency)
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	for _, c := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c types.Container) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := s.runBulkAction(req, c, author)
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	resp := BulkResponse{Action: req.Action, Total: len(results), Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case "error":
+			resp.Failed++
+		case "skipped":
+			resp.Skipped++
+		default:
+			resp.Succeeded++
+		}
+	}
+
+	status := http.StatusOK
+	if resp.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	s.json(w, status, resp)
+}
+
+// selectBulkTargets resolves the selector against the managed containers.
+// IDs that match nothing are reported as failed results, and those of
+// servers lacking one of the tags as skipped ones.
+func selectBulkTargets(containers []types.Container, ids, tags []string) ([]types.Container, []BulkResult) {
+	var targets []types.Container
+	results := []BulkResult{}
+	seen := make(map[string]bool)
+
+	managed := []types.Container{}
+	for _, c := range containers {
+		if c.Labels["cloudstrike"] == "true" {
+			managed = append(managed, c)
+		}
+	}
+
+	for _, id := range ids {
+		found := false
+		for _, c := range managed {
+			if docker.MatchesServerID(c.ID, c.Labels, id) {
+				found = true
+				if !seen[c.ID] {
+					seen[c.ID] = true
+					if missing := missingTags(c, tags); len(missing) > 0 {
+						results = append(results, BulkResult{
+							ID:     docker.ServerID(c.ID, c.Labels),
+							Name:   c.Labels["cloudstrike.name"],
+							Status: "skipped",
+							Reason: "missing tags: " + strings.Join(missing, ", "),
+						})
+					} else {
+						targets = append(targets, c)
+					}
+				}
+				break
+			}
+		}
+		if !found {
+			results = append(results, BulkResult{ID: id, Status: "error", Error: "server not found"})
+		}
+	}
+
+	if len(ids) == 0 {
+		for _, c := range managed {
+			if len(missingTags(c, tags)) == 0 {
+				targets = append(targets, c)
+			}
+		}
+	}
+
+	return targets, results
+}
+
+// missingTags returns the tags the container doesn't have.
+func missingTags(c types.Container, tags []string) []string {
+	have := make(map[string]bool)
+	for _, tag := range docker.ServerTags(c.Labels) {
+		have[tag] = true
+	}
+	var missing []string
+	for _, tag := range tags {
+		if !have[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
+func (s *Server) runBulkAction(req BulkRequest, c types.Container, author string) BulkResult {
+	shortID := docker.ServerID(c.ID, c.Labels)
+	result := BulkResult{ID: shortID, Name: c.Labels["cloudstrike.name"], Status: "ok"}
+
+	var err error
+	switch req.Action {
+	case "start":
+		_, _, err = s.startServer(c.ID)
+	case "stop", "restart":
+		var job *jobs.Job
+		job, err = s.stopServer(shortID, c.ID, req.Stop, req.Action == "restart")
+		if job != nil && err == nil {
+			result.Status = "scheduled"
+			result.Job = job
+		}
+	case "delete":
+		err = s.deleteServer(c.ID, req.DeleteData)
+	case "settings":
+		_, err = s.patchSettings(shortID, c.ID, author, req.Settings)
+	}
+
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+	return result
+}
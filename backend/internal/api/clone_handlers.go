@@ -0,0 +1,310 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/jobs"
+)
+
+const jobKindClone = "clone"
+
+var errNoFreePort = errors.New("no free port left in SERVER_PORTS")
+
+// CloneServerRequest names the new server. Port and RconPassword are
+// allocated when left out, and Tags default to those of the source.
+type CloneServerRequest struct {
+	Name         string   `json:"name"`
+	Port         string   `json:"port"`
+	RconPassword string   `json:"rconPassword"`
+	Tags         []string `json:"tags"`
+	// CopyData copies the whole data volume instead of the config and
+	// plugin paths in CLONE_PATHS. The source must be stopped, so the
+	// copy doesn't catch files it is writing.
+	CopyData bool `json:"copyData"`
+}
+
+// ResourceLimits summarizes the limits a clone took over; zero is
+// unlimited.
+type ResourceLimits struct {
+	Memory int64   `json:"memory"`
+	CPUs   float64 `json:"cpus"`
+}
+
+type CloneServerResponse struct {
+	ServerResponse
+	Source       string         `json:"source"`
+	Template     string         `json:"template"`
+	RconPassword string         `json:"rconPassword"`
+	Limits       ResourceLimits `json:"limits"`
+	// CopyData is set when the whole data volume is copied; otherwise
+	// Copied lists the paths copied from the source.
+	CopyData bool     `json:"copyData"`
+	Copied   []string `json:"copied"`
+	Job      jobs.Job `json:"job"`
+	Warning  string   `json:"warning,omitempty"`
+}
+
+// handleCloneServer creates a server with the template, settings, resource
+// limits, workshop content and map rotation of another one. It gets its own
+// port and RCON password. The files are copied and the clone started in a
+// job, as copying a whole volume can take a while. If the job fails, the
+// clone is removed again.
+func (s *Server) handleCloneServer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req CloneServerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	if req.Name == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "name required"})
+		return
+	}
+	if !validServerName(req.Name) {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": errServerName.Error()})
+		return
+	}
+	for _, tag := range req.Tags {
+		if !validTag(tag) {
+			s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid tag: " + tag})
+			return
+		}
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+	state, err := s.docker.State(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	labels := state.Labels
+	if req.CopyData && state.Running {
+		s.json(w, http.StatusConflict, map[string]string{"error": "stop the server before copying its whole data volume"})
+		return
+	}
+
+	containers, err := s.docker.ListContainers()
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	used := map[string]bool{}
+	for _, c := range containers {
+		if c.Labels["cloudstrike"] != "true" {
+			continue
+		}
+		// Creating a server replaces any container of the same name.
+		if c.Labels["cloudstrike.name"] == req.Name {
+			s.json(w, http.StatusConflict, map[string]string{"error": "a server named " + req.Name + " already exists"})
+			return
+		}
+		used[c.Labels["cloudstrike.port"]] = true
+	}
+	// The volume of a server deleted without its data would be mounted as
+	// is, mixing its files into the clone.
+	exists, err := s.docker.VolumeExists(docker.DataVolume(req.Name))
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if exists {
+		s.json(w, http.StatusConflict, map[string]string{"error": "the data volume of a deleted server named " + req.Name + " still exists; delete it or pick another name"})
+		return
+	}
+	if req.Port == "" {
+		if req.Port, err = s.allocatePort(used); err != nil {
+			s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+	} else if used[req.Port] {
+		s.json(w, http.StatusConflict, map[string]string{"error": "port " + req.Port + " is used by another server"})
+		return
+	}
+	if req.RconPassword == "" {
+		req.RconPassword = newRconPassword()
+	}
+	if req.Tags == nil {
+		req.Tags = docker.ServerTags(labels)
+	}
+
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	settings.ServerName = req.Name
+	settings.RconPassword = req.RconPassword
+	if err := validateSettings(settings); err != nil {
+		s.settingsError(w, err)
+		return
+	}
+
+	resources, err := s.docker.ContainerResources(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	template := labels["cloudstrike.template"]
+	if template == "" {
+		template = files.DefaultTemplate
+	}
+
+	// The clone takes over the source's workshop config, so its launch
+	// arguments come from the source until the config is stored for the
+	// clone below.
+	source := s.serverKey(fullID)
+	ws, err := s.workshop.Get(source)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	env, err := s.serverEnv(source, settings)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	newID, err := s.docker.CreateGameServer(docker.GameServerSpec{
+		Name:         req.Name,
+		Port:         req.Port,
+		RconPassword: req.RconPassword,
+		Template:     template,
+		Tags:         req.Tags,
+		DataDir:      s.cfg.FilesRoot,
+		Env:          env,
+		Resources:    resources,
+	})
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	putSettings(req.Name, settings)
+	if len(ws.Maps) > 0 || ws.Collection != "" {
+		if err := s.workshop.Put(req.Name, ws); err != nil {
+			s.removeClone(newID)
+			s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	rot, hasRotation, err := s.rotations.Rotation(source)
+	if err != nil {
+		s.removeClone(newID)
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if hasRotation {
+		rot.LastMap = ""
+		rot.LastRotated = time.Now()
+		if err := s.rotations.PutRotation(req.Name, rot); err != nil {
+			s.removeClone(newID)
+			s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	resp := CloneServerResponse{
+		ServerResponse: ServerResponse{
+			ID:     newID[:12],
+			Name:   req.Name,
+			Port:   req.Port,
+			Status: "created",
+			Tags:   req.Tags,
+		},
+		Source:       docker.ServerID(fullID, labels),
+		Template:     template,
+		RconPassword: req.RconPassword,
+		Limits:       ResourceLimits{Memory: resources.Memory, CPUs: float64(resources.NanoCPUs) / 1e9},
+		Copied:       []string{},
+	}
+
+	// CopyVolume copies the whole volume when given no paths.
+	var paths []string
+	srcVolume := labels["cloudstrike.volume"]
+	copyFiles := srcVolume != "" && (req.CopyData || len(s.cfg.ClonePaths) > 0)
+	switch {
+	case srcVolume == "":
+		resp.Warning = "the source server has no data volume, so no files were copied"
+	case req.CopyData:
+		resp.CopyData = true
+	default:
+		paths = s.cfg.ClonePaths
+		resp.Copied = paths
+	}
+
+	author := s.requestAuthor(r)
+	resp.Job = s.jobs.Start(jobKindClone, resp.ID, func(ctx context.Context, rep jobs.Reporter) error {
+		populate := func() error {
+			if copyFiles {
+				rep.Report(0, "copying files")
+				if err := s.docker.CopyVolume(ctx, fullID, srcVolume, docker.DataVolume(req.Name), s.cfg.FilesRoot, paths); err != nil {
+					return err
+				}
+			}
+
+			// The copied files may predate the source's current settings.
+			rep.Report(80, "writing managed config")
+			if len(settings.Cvars) > 0 {
+				if err := s.writeManagedCfg(newID, author, settings.Cvars); err != nil {
+					return err
+				}
+			}
+			if hasRotation {
+				if err := s.writeGameModes(ctx, newID, false); err != nil && !errors.Is(err, errUnmanagedGameModes) {
+					return err
+				}
+			}
+
+			rep.Report(90, "starting server")
+			return s.docker.StartContainer(newID)
+		}
+		if err := populate(); err != nil {
+			rep.Report(95, "removing the clone")
+			s.removeClone(newID)
+			return err
+		}
+		return nil
+	})
+
+	s.json(w, http.StatusAccepted, resp)
+}
+
+// removeClone deletes a clone that could not be set up, data included, so
+// its name and port can be used again.
+func (s *Server) removeClone(newID string) {
+	if err := s.deleteServer(newID, true); err != nil {
+		log.Printf("Failed to remove the clone %s: %v", newID[:12], err)
+	}
+}
+
+// allocatePort returns the lowest port of SERVER_PORTS that no server uses.
+func (s *Server) allocatePort(used map[string]bool) (string, error) {
+	for port := s.cfg.ServerPortMin; port <= s.cfg.ServerPortMax; port++ {
+		if p := strconv.Itoa(port); !used[p] {
+			return p, nil
+		}
+	}
+	return "", errNoFreePort
+}
+
+// newRconPassword returns a random RCON password.
+func newRconPassword() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gorilla/websocket"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+// ConsoleMessage is sent by the client as JSON text. Commands are written to
+// the game server's stdin followed by a newline.
+type ConsoleMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols uint   `json:"cols,omitempty"`
+	Rows uint   `json:"rows,omitempty"`
+}
+
+func (s *Server) handleConsole(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	session, err := s.docker.AttachConsole(fullID)
+	if errors.Is(err, docker.ErrNoStdin) || errors.Is(err, docker.ErrNotRunning) {
+		s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer session.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	user, _ := userFromContext(r.Context())
+	log.Printf("Console attached to %s by %s", id, user.Name)
+	defer log.Printf("Console detached from %s by %s", id, user.Name)
+
+	out := &wsWriter{conn: conn}
+
+	// Replay recent output so the operator sees where the server is at.
+	if tail := r.URL.Query().Get("tail"); tail != "" {
+		if logs, err := s.docker.GetContainerLogs(fullID, tail); err == nil {
+			out.Write([]byte(logs))
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if session.TTY {
+			io.Copy(out, session.Conn.Reader)
+		} else {
+			stdcopy.StdCopy(out, out, session.Conn.Reader)
+		}
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "server stopped"),
+			time.Now().Add(time.Second))
+	}()
+
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				session.Close()
+				return
+			}
+
+			var msg ConsoleMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "command":
+				if cmd := sanitizeConsoleCommand(msg.Data); cmd != "" {
+					session.Conn.Conn.Write([]byte(cmd + "\n"))
+				}
+			case "resize":
+				if session.TTY && msg.Cols > 0 && msg.Rows > 0 {
+					s.docker.ResizeContainer(fullID, msg.Cols, msg.Rows)
+				}
+			}
+		}
+	}()
+
+	<-done
+}
+
+// sanitizeConsoleCommand drops control characters so a command can't send
+// ^C to srcds through the TTY and kill the server.
+func sanitizeConsoleCommand(cmd string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r < 32 || r == 127 {
+			return -1
+		}
+		return r
+	}, cmd))
+}
+
+// wsWriter forwards writes as binary WebSocket messages.
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *wsWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+type ExecRequest struct {
+	Cmd        []string `json:"cmd"`
+	WorkingDir string   `json:"workingDir"`
+	Env        []string `json:"env"`
+	// TimeoutSeconds defaults to EXEC_TIMEOUT and is capped at EXEC_MAX_TIMEOUT.
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+type ExecResponse struct {
+	*docker.ExecResult
+	DurationMs int64 `json:"durationMs"`
+}
+
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	var req ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+
+	if len(req.Cmd) == 0 || req.Cmd[0] == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "cmd required"})
+		return
+	}
+
+	timeout := s.cfg.ExecTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	if timeout > s.cfg.ExecMaxTimeout {
+		timeout = s.cfg.ExecMaxTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	user, _ := userFromContext(r.Context())
+	log.Printf("Exec on %s by %s: %q", id, user.Name, req.Cmd)
+
+	start := time.Now()
+	result, err := s.docker.ExecInContainer(ctx, fullID, req.Cmd, docker.ExecOptions{
+		WorkingDir: req.WorkingDir,
+		Env:        req.Env,
+		MaxOutput:  s.cfg.ExecMaxOutput,
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		s.json(w, http.StatusGatewayTimeout, map[string]string{"error": fmt.Sprintf("command timed out after %s", timeout)})
+		return
+	}
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.json(w, http.StatusOK, ExecResponse{
+		ExecResult: result,
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+}
+
+// execFailure describes a command that exited non-zero, preferring its stderr.
+func execFailure(result *docker.ExecResult) string {
+	if msg := strings.TrimSpace(result.Stderr); msg != "" {
+		return msg
+	}
+	if msg := strings.TrimSpace(result.Stdout); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("command exited with code %d", result.ExitCode)
+}
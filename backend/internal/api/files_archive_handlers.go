@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/jobs"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+)
+
+const (
+	jobKindExtract  = "extract"
+	jobKindCompress = "compress"
+)
+
+// ExtractRequest unpacks an archive. Destination defaults to the directory
+// holding the archive; Overwrite is one of overwrite (default), skip, error.
+type ExtractRequest struct {
+	Path        string `json:"path"`
+	Destination string `json:"destination"`
+	Overwrite   string `json:"overwrite"`
+}
+
+// CompressRequest packs paths into the archive at Destination. Format is zip
+// or tar.gz and defaults to the extension of Destination.
+type CompressRequest struct {
+	Paths       []string `json:"paths"`
+	Destination string   `json:"destination"`
+	Format      string   `json:"format"`
+	Overwrite   bool     `json:"overwrite"`
+}
+
+func (s *Server) handleExtract(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req ExtractRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	if req.Path == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return
+	}
+	if files.ArchiveFormat(req.Path) == "" {
+		s.fileError(w, files.ErrArchiveFormat)
+		return
+	}
+	switch req.Overwrite {
+	case "", files.OverwriteReplace, files.OverwriteSkip, files.OverwriteError:
+	default:
+		s.fileError(w, files.ErrOverwrite)
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	archive, err := s.files.Resolve(fullID, req.Path, files.Read)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	if req.Destination == "" {
+		req.Destination = filepath.Dir(archive)
+	}
+	dest, err := s.files.Resolve(fullID, req.Destination, files.Write)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	author := s.requestAuthor(r)
+	serverID, err := s.serverID(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	job := s.jobs.Start(jobKindExtract, serverID, func(ctx context.Context, rep jobs.Reporter) error {
+		// Config files replaced by the archive keep their history.
+		var tracked []string
+		result, err := s.files.Extract(ctx, fullID, archive, dest, req.Overwrite, rep.Report, func(paths []string) {
+			for _, p := range paths {
+				if revisionTracked(p) {
+					s.recordBaseline(fullID, p, nil)
+					tracked = append(tracked, p)
+				}
+			}
+		})
+		for _, p := range tracked {
+			s.recordFile(fullID, p, author, revisions.ActionWrite)
+		}
+		if err != nil {
+			return err
+		}
+		rep.SetResult(result)
+		return nil
+	})
+	s.json(w, http.StatusAccepted, map[string]interface{}{"status": "extract scheduled", "job": job})
+}
+
+func (s *Server) handleCompress(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req CompressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	if len(req.Paths) == 0 || req.Destination == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "paths and destination required"})
+		return
+	}
+	if req.Format == "" {
+		req.Format = files.ArchiveFormat(req.Destination)
+	}
+	if req.Format != files.FormatZip && req.Format != files.FormatTarGz {
+		s.fileError(w, files.ErrFormat)
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	paths := make([]string, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		resolved, err := s.files.Resolve(fullID, p, files.Read)
+		if err != nil {
+			s.fileError(w, err)
+			return
+		}
+		paths = append(paths, resolved)
+	}
+	dest, err := s.files.Resolve(fullID, req.Destination, files.Write)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	if err := s.files.CheckTarget(fullID, dest, req.Overwrite); err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	serverID, err := s.serverID(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	job := s.jobs.Start(jobKindCompress, serverID, func(ctx context.Context, rep jobs.Reporter) error {
+		result, err := s.files.Compress(ctx, fullID, paths, dest, req.Format, rep.Report)
+		if err != nil {
+			return err
+		}
+		rep.SetResult(result)
+		return nil
+	})
+	s.json(w, http.StatusAccepted, map[string]interface{}{"status": "compress scheduled", "job": job})
+}
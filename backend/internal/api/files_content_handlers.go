@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+)
+
+// New files created through the editor get these permissions.
+const defaultFileMode = 0o644
+
+type FileContentResponse struct {
+	Path     string    `json:"path"`
+	Content  string    `json:"content"`
+	Encoding string    `json:"encoding"`
+	Size     int64     `json:"size"`
+	ETag     string    `json:"etag"`
+	ModTime  time.Time `json:"modTime"`
+}
+
+// FileContentRequest replaces a text file. Encoding defaults to the encoding
+// of the existing file, or UTF-8 for new files.
+type FileContentRequest struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+type FileWriteResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+func (s *Server) handleGetFileContent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	path, err = s.files.Resolve(fullID, path, files.Read)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	file, err := s.files.ReadFile(fullID, path, s.cfg.FilesEditMax)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	etag := file.ETag()
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	content, encoding, err := files.DecodeText(file.Data)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	s.json(w, http.StatusOK, FileContentResponse{
+		Path:     path,
+		Content:  content,
+		Encoding: encoding,
+		Size:     int64(len(file.Data)),
+		ETag:     etag,
+		ModTime:  file.ModTime,
+	})
+}
+
+// handlePutFileContent writes a text file. With If-Match the write only
+// succeeds if the file still has that ETag; "*" requires the file to exist.
+func (s *Server) handlePutFileContent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return
+	}
+
+	var req FileContentRequest
+	// JSON escaping can blow the content up several times over.
+	r.Body = http.MaxBytesReader(w, r.Body, 6*s.cfg.FilesEditMax+4096)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.fileError(w, files.ErrTooLarge)
+			return
+		}
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	path, err = s.files.Resolve(fullID, path, files.Write)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	unlock := s.files.Lock(fullID, path)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileExecTimeout)
+	defer cancel()
+
+	ifMatch := r.Header.Get("If-Match")
+	current, err := s.files.ReadFile(fullID, path, s.cfg.FilesEditMax)
+	switch {
+	case errors.Is(err, docker.ErrPathNotFound):
+		current = nil
+	case err != nil:
+		s.fileError(w, err)
+		return
+	}
+
+	if ifMatch != "" {
+		if current == nil {
+			s.json(w, http.StatusPreconditionFailed, map[string]string{"error": "file no longer exists"})
+			return
+		}
+		if etag := current.ETag(); ifMatch != "*" && ifMatch != etag {
+			w.Header().Set("ETag", etag)
+			s.json(w, http.StatusPreconditionFailed, map[string]string{"error": "file was modified since it was read", "etag": etag})
+			return
+		}
+	}
+
+	encoding := req.Encoding
+	mode := int64(defaultFileMode)
+	var uid, gid int
+	if current != nil {
+		if encoding == "" {
+			_, encoding, _ = files.DecodeText(current.Data)
+		}
+		mode, uid, gid = current.Mode, current.Uid, current.Gid
+	} else {
+		// New files take the owner of the directory they are created in.
+		uid, gid, err = s.files.Owner(ctx, fullID, filepath.Dir(path))
+		if err != nil {
+			s.fileError(w, err)
+			return
+		}
+	}
+
+	data, err := files.EncodeText(req.Content, encoding)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	if int64(len(data)) > s.cfg.FilesEditMax {
+		s.fileError(w, files.ErrTooLarge)
+		return
+	}
+
+	if current != nil {
+		s.recordBaseline(fullID, path, current)
+	}
+	if err := s.files.WriteFile(ctx, fullID, path, data, mode, uid, gid); err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.recordRevision(fullID, path, s.requestAuthor(r), revisions.ActionWrite, data)
+
+	etag := files.ETag(data)
+	w.Header().Set("ETag", etag)
+	s.json(w, http.StatusOK, FileWriteResponse{Path: path, Size: int64(len(data)), ETag: etag})
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+)
+
+// fileExecTimeout bounds the shell commands the file manager runs in containers.
+const fileExecTimeout = 30 * time.Second
+
+// maxListLimit caps one page of a directory listing.
+const maxListLimit = 5000
+
+// handleListFiles returns the entries of a directory as an array. The total
+// number of entries is reported in X-Total-Count when paginating.
+func (s *Server) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	query := r.URL.Query()
+
+	sortKey := query.Get("sort")
+	desc := false
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "order must be asc or desc"})
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid offset"})
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), 0)
+	if err != nil || limit < 0 || limit > maxListLimit {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 0 and " + strconv.Itoa(maxListLimit)})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	path, err := s.files.Resolve(fullID, query.Get("path"), files.Read)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileExecTimeout)
+	defer cancel()
+
+	entries, err := s.files.List(ctx, fullID, path)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	if err := files.SortEntries(entries, sortKey, desc); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(entries)))
+	entries = entries[min(offset, len(entries)):]
+	if limit > 0 {
+		entries = entries[:min(limit, len(entries))]
+	}
+	s.json(w, http.StatusOK, entries)
+}
+
+func queryInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func (s *Server) handleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	path, err = s.files.Resolve(fullID, path, files.Modify)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileExecTimeout)
+	defer cancel()
+
+	if err := s.files.Remove(ctx, fullID, path); err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	s.json(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleDownloadFile serves a single file as is, with Range support, and
+// streams directories or several paths as a zip or tar.gz archive.
+func (s *Server) handleDownloadFile(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	query := r.URL.Query()
+	paths := query["path"]
+	if len(paths) == 0 {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != files.FormatZip && format != files.FormatTarGz {
+		s.fileError(w, files.ErrFormat)
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	resolved := make([]string, 0, len(paths))
+	isDir := false
+	for _, p := range paths {
+		path, err := s.files.Resolve(fullID, p, files.Read)
+		if err != nil {
+			s.fileError(w, err)
+			return
+		}
+		// Stat up front so a missing path is a 404 rather than a broken stream.
+		if isDir, err = s.files.IsDir(fullID, path); err != nil {
+			s.fileError(w, err)
+			return
+		}
+		resolved = append(resolved, path)
+	}
+
+	if len(resolved) == 1 && !isDir && format == "" {
+		s.serveFile(w, r, fullID, resolved[0])
+		return
+	}
+
+	if format == "" {
+		format = files.FormatZip
+	}
+	name := "files"
+	if len(resolved) == 1 {
+		name = filepath.Base(resolved[0])
+	}
+
+	aw, err := files.NewArchiveWriter(format, w)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", files.ArchiveContentType(format))
+	w.Header().Set("Content-Disposition", attachment(name+files.ArchiveExt(format)))
+	if err := s.files.WriteArchive(fullID, resolved, aw); err != nil {
+		// The status line is already sent; the client sees a truncated archive.
+		log.Printf("Archive download from %s failed: %v", id, err)
+	}
+}
+
+// serveFile streams one regular file. Docker only hands out whole files, so
+// for a Range request the bytes before the range are read and discarded.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, fullID, path string) {
+	reader, err := s.docker.CopyFromContainer(fullID, path)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	hdr, err := tr.Next()
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		s.fileError(w, files.ErrNotRegular)
+		return
+	}
+
+	size := hdr.Size
+	lastModified := hdr.ModTime.UTC().Format(http.TimeFormat)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Last-Modified", lastModified)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", attachment(filepath.Base(path)))
+
+	rangeHeader := r.Header.Get("Range")
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != lastModified {
+		rangeHeader = ""
+	}
+	start, length, ok := parseRange(rangeHeader, size)
+	if !ok {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if length == size {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, tr)
+		return
+	}
+
+	if _, err := io.CopyN(io.Discard, tr, start); err != nil {
+		log.Printf("Ranged download of %s failed: %v", path, err)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	io.CopyN(w, tr, length)
+}
+
+// parseRange parses a single byte range against size. An empty or
+// multi-range header selects the whole file; ok is false only when the
+// range cannot be satisfied.
+func parseRange(header string, size int64) (start, length int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || size == 0 || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, size, true
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		n = min(n, size)
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true
+}
+
+func attachment(name string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
+
+// fileError maps sandbox and lookup failures to HTTP responses.
+func (s *Server) fileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, files.ErrOutsideRoot), errors.Is(err, files.ErrReadOnly), errors.Is(err, files.ErrIsRoot):
+		s.json(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, files.ErrBadLink), errors.Is(err, files.ErrNotDir), errors.Is(err, files.ErrNotRegular),
+		errors.Is(err, files.ErrFormat), errors.Is(err, files.ErrArchiveFormat), errors.Is(err, files.ErrOverwrite),
+		errors.Is(err, files.ErrUnsafeEntry), errors.Is(err, files.ErrPattern):
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, files.ErrTooLarge), errors.Is(err, files.ErrTooManyEntries):
+		s.json(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	case errors.Is(err, files.ErrBinary), errors.Is(err, files.ErrEncoding):
+		s.json(w, http.StatusUnsupportedMediaType, map[string]string{"error": err.Error()})
+	case errors.Is(err, files.ErrExists), errors.Is(err, files.ErrNoVolume):
+		s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, docker.ErrPathNotFound):
+		s.json(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, context.DeadlineExceeded):
+		s.json(w, http.StatusGatewayTimeout, map[string]string{"error": err.Error()})
+	default:
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
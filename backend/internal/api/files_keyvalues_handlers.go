@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/jsonpatch"
+	"github.com/chi2l3s/cloudstrike/internal/keyvalues"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+)
+
+type KeyValuesResponse struct {
+	Path     string              `json:"path"`
+	Encoding string              `json:"encoding"`
+	Size     int64               `json:"size"`
+	ETag     string              `json:"etag"`
+	ModTime  time.Time           `json:"modTime"`
+	Document *keyvalues.Document `json:"document"`
+}
+
+// KeyValuesErrorResponse reports a file that isn't valid KeyValues, with the
+// position of the problem.
+type KeyValuesErrorResponse struct {
+	Error  string                 `json:"error"`
+	Syntax *keyvalues.SyntaxError `json:"syntax,omitempty"`
+	// Node is the JSON Pointer of the node that can't be written.
+	Node string `json:"node,omitempty"`
+}
+
+// handleGetKeyValues returns a KeyValues file as a JSON tree.
+func (s *Server) handleGetKeyValues(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	path, err = s.files.Resolve(fullID, path, files.Read)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	file, err := s.files.ReadFile(fullID, path, s.cfg.FilesEditMax)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	etag := file.ETag()
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	doc, encoding, err := parseKeyValuesFile(file)
+	if err != nil {
+		s.keyValuesError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	s.json(w, http.StatusOK, KeyValuesResponse{
+		Path:     path,
+		Encoding: encoding,
+		Size:     int64(len(file.Data)),
+		ETag:     etag,
+		ModTime:  file.ModTime,
+		Document: doc,
+	})
+}
+
+// handlePutKeyValues writes a whole JSON tree as a KeyValues file, creating
+// it if needed. If-Match works as for the text editor.
+func (s *Server) handlePutKeyValues(w http.ResponseWriter, r *http.Request) {
+	s.writeKeyValues(w, r, func(current *keyvalues.Document, body []byte) (*keyvalues.Document, error) {
+		var doc keyvalues.Document
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, errInvalidRequest
+		}
+		return &doc, nil
+	}, false)
+}
+
+// handlePatchKeyValues applies a JSON Patch (RFC 6902) to the JSON tree of
+// an existing KeyValues file and writes the result back.
+func (s *Server) handlePatchKeyValues(w http.ResponseWriter, r *http.Request) {
+	s.writeKeyValues(w, r, func(current *keyvalues.Document, body []byte) (*keyvalues.Document, error) {
+		ops, err := jsonpatch.Decode(body)
+		if err != nil {
+			return nil, errInvalidRequest
+		}
+		tree, err := json.Marshal(current)
+		if err != nil {
+			return nil, err
+		}
+		patched, err := jsonpatch.Apply(tree, ops)
+		if err != nil {
+			return nil, err
+		}
+		var doc keyvalues.Document
+		if err := json.Unmarshal(patched, &doc); err != nil {
+			return nil, &keyvalues.ValidationError{Path: "", Message: "patched document is not a KeyValues tree: " + err.Error()}
+		}
+		return &doc, nil
+	}, true)
+}
+
+var errInvalidRequest = errors.New("invalid request")
+
+// writeKeyValues reads the file at ?path=, builds the new document from it
+// and the request body with update, and writes it back as KeyValues. The
+// current document is nil for a new file; mustExist refuses those.
+func (s *Server) writeKeyValues(w http.ResponseWriter, r *http.Request, update func(current *keyvalues.Document, body []byte) (*keyvalues.Document, error), mustExist bool) {
+	id := r.PathValue("id")
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return
+	}
+
+	// The JSON tree is several times larger than the file it describes.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 8*s.cfg.FilesEditMax+4096))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.fileError(w, files.ErrTooLarge)
+			return
+		}
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	path, err = s.files.Resolve(fullID, path, files.Write)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	unlock := s.files.Lock(fullID, path)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileExecTimeout)
+	defer cancel()
+
+	current, err := s.files.ReadFile(fullID, path, s.cfg.FilesEditMax)
+	switch {
+	case errors.Is(err, docker.ErrPathNotFound):
+		if mustExist {
+			s.fileError(w, err)
+			return
+		}
+		current = nil
+	case err != nil:
+		s.fileError(w, err)
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if current == nil {
+			s.json(w, http.StatusPreconditionFailed, map[string]string{"error": "file no longer exists"})
+			return
+		}
+		if etag := current.ETag(); ifMatch != "*" && ifMatch != etag {
+			w.Header().Set("ETag", etag)
+			s.json(w, http.StatusPreconditionFailed, map[string]string{"error": "file was modified since it was read", "etag": etag})
+			return
+		}
+	}
+
+	encoding := "utf-8"
+	var currentDoc *keyvalues.Document
+	mode := int64(defaultFileMode)
+	var uid, gid int
+	if current != nil {
+		currentDoc, encoding, err = parseKeyValuesFile(current)
+		if err != nil && mustExist {
+			s.keyValuesError(w, err)
+			return
+		}
+		if err != nil {
+			// A broken file can still be replaced as a whole.
+			_, encoding, _ = files.DecodeText(current.Data)
+		}
+		mode, uid, gid = current.Mode, current.Uid, current.Gid
+	} else {
+		// New files take the owner of the directory they are created in.
+		uid, gid, err = s.files.Owner(ctx, fullID, filepath.Dir(path))
+		if err != nil {
+			s.fileError(w, err)
+			return
+		}
+	}
+
+	doc, err := update(currentDoc, body)
+	if err != nil {
+		s.keyValuesError(w, err)
+		return
+	}
+	if err := doc.Validate(); err != nil {
+		s.keyValuesError(w, err)
+		return
+	}
+	if doc.Nodes == nil {
+		doc.Nodes = []*keyvalues.Node{}
+	}
+
+	data, err := files.EncodeText(string(keyvalues.Format(doc)), encoding)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	if int64(len(data)) > s.cfg.FilesEditMax {
+		s.fileError(w, files.ErrTooLarge)
+		return
+	}
+
+	if current != nil {
+		s.recordBaseline(fullID, path, current)
+	}
+	if err := s.files.WriteFile(ctx, fullID, path, data, mode, uid, gid); err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.recordRevision(fullID, path, s.requestAuthor(r), revisions.ActionWrite, data)
+
+	etag := files.ETag(data)
+	w.Header().Set("ETag", etag)
+	s.json(w, http.StatusOK, KeyValuesResponse{
+		Path:     path,
+		Encoding: encoding,
+		Size:     int64(len(data)),
+		ETag:     etag,
+		ModTime:  time.Now(),
+		Document: doc,
+	})
+}
+
+// parseKeyValuesFile decodes a text file and parses it as KeyValues.
+func parseKeyValuesFile(file *files.File) (*keyvalues.Document, string, error) {
+	text, encoding, err := files.DecodeText(file.Data)
+	if err != nil {
+		return nil, "", err
+	}
+	doc, err := keyvalues.Parse(text)
+	return doc, encoding, err
+}
+
+// keyValuesError writes the response for a failed KeyValues read or write.
+func (s *Server) keyValuesError(w http.ResponseWriter, err error) {
+	var syntax *keyvalues.SyntaxError
+	var invalid *keyvalues.ValidationError
+	var patch *jsonpatch.Error
+	switch {
+	case errors.As(err, &syntax):
+		s.json(w, http.StatusUnprocessableEntity, KeyValuesErrorResponse{Error: "file is not valid KeyValues: " + err.Error(), Syntax: syntax})
+	case errors.As(err, &invalid):
+		s.json(w, http.StatusBadRequest, KeyValuesErrorResponse{Error: invalid.Message, Node: invalid.Path})
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.As(err, &patch):
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, errInvalidRequest):
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	default:
+		s.fileError(w, err)
+	}
+}
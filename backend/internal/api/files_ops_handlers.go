@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+)
+
+const (
+	// fileOpTimeout bounds a whole batch; recursive copies can take a while.
+	fileOpTimeout  = 10 * time.Minute
+	maxFileOpPaths = 1000
+)
+
+// FileOpRequest is the body of the batch file operations. Which fields are
+// used depends on the operation:
+//
+//	mkdir:  paths
+//	rename: items
+//	move:   paths, destination, overwrite
+//	copy:   paths, destination, overwrite
+//	chmod:  paths, mode, recursive
+type FileOpRequest struct {
+	Paths       []string     `json:"paths"`
+	Items       []FileRename `json:"items"`
+	Destination string       `json:"destination"`
+	Overwrite   bool         `json:"overwrite"`
+	Mode        string       `json:"mode"`
+	Recursive   bool         `json:"recursive"`
+}
+
+type FileRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type FileOpResult struct {
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type FileOpResponse struct {
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []FileOpResult `json:"results"`
+}
+
+func (s *Server) handleMkdir(w http.ResponseWriter, r *http.Request) {
+	s.fileOps(w, r, func(ctx context.Context, fullID string, req FileOpRequest) ([]FileOpResult, error) {
+		if len(req.Paths) == 0 {
+			return nil, errors.New("paths required")
+		}
+		results := make([]FileOpResult, 0, len(req.Paths))
+		for _, p := range req.Paths {
+			result := FileOpResult{Path: p}
+			dir, err := s.files.Resolve(fullID, p, files.Write)
+			if err == nil {
+				err = s.files.Mkdir(ctx, fullID, dir)
+			}
+			results = append(results, fileOpResult(result, dir, err))
+		}
+		return results, nil
+	})
+}
+
+func (s *Server) handleRenameFiles(w http.ResponseWriter, r *http.Request) {
+	s.fileOps(w, r, func(ctx context.Context, fullID string, req FileOpRequest) ([]FileOpResult, error) {
+		if len(req.Items) == 0 {
+			return nil, errors.New("items required")
+		}
+		results := make([]FileOpResult, 0, len(req.Items))
+		for _, item := range req.Items {
+			result := FileOpResult{Path: item.From}
+			// A bare name renames within the same directory.
+			to := item.To
+			if to != "" && path.Base(to) == to {
+				to = path.Join(path.Dir(item.From), to)
+			}
+			results = append(results, s.moveOrCopy(ctx, fullID, s.requestAuthor(r), result, item.From, to, false, false))
+		}
+		return results, nil
+	})
+}
+
+func (s *Server) handleMoveFiles(w http.ResponseWriter, r *http.Request) {
+	s.transferFiles(w, r, false)
+}
+
+func (s *Server) handleCopyFiles(w http.ResponseWriter, r *http.Request) {
+	s.transferFiles(w, r, true)
+}
+
+// transferFiles moves or copies every path into the destination directory,
+// keeping base names.
+func (s *Server) transferFiles(w http.ResponseWriter, r *http.Request, copyFiles bool) {
+	s.fileOps(w, r, func(ctx context.Context, fullID string, req FileOpRequest) ([]FileOpResult, error) {
+		if len(req.Paths) == 0 || req.Destination == "" {
+			return nil, errors.New("paths and destination required")
+		}
+		results := make([]FileOpResult, 0, len(req.Paths))
+		for _, p := range req.Paths {
+			result := FileOpResult{Path: p}
+			to := path.Join(req.Destination, path.Base(p))
+			results = append(results, s.moveOrCopy(ctx, fullID, s.requestAuthor(r), result, p, to, copyFiles, req.Overwrite))
+		}
+		return results, nil
+	})
+}
+
+// moveOrCopy records the new content of dst in its revision history when
+// dst is a tracked config file; author names who asked for it.
+func (s *Server) moveOrCopy(ctx context.Context, fullID, author string, result FileOpResult, from, to string, copyFiles, overwrite bool) FileOpResult {
+	srcAccess := files.Modify
+	if copyFiles {
+		srcAccess = files.Read
+	}
+	src, err := s.files.Resolve(fullID, from, srcAccess)
+	if err != nil {
+		return fileOpResult(result, "", err)
+	}
+	if to == "" {
+		return fileOpResult(result, "", errors.New("target required"))
+	}
+	dst, err := s.files.Resolve(fullID, to, files.Write)
+	if err != nil {
+		return fileOpResult(result, "", err)
+	}
+	if dst == src || strings.HasPrefix(dst, src+"/") {
+		return fileOpResult(result, dst, errors.New("cannot move or copy a directory into itself"))
+	}
+
+	if overwrite {
+		s.recordBaseline(fullID, dst, nil)
+	}
+	action := revisions.ActionMove
+	if copyFiles {
+		action = revisions.ActionCopy
+		err = s.files.Copy(ctx, fullID, src, dst, overwrite)
+	} else {
+		err = s.files.Move(ctx, fullID, src, dst, overwrite)
+	}
+	if err == nil {
+		s.recordFile(fullID, dst, author, action)
+	}
+	return fileOpResult(result, dst, err)
+}
+
+func (s *Server) handleChmodFiles(w http.ResponseWriter, r *http.Request) {
+	s.fileOps(w, r, func(ctx context.Context, fullID string, req FileOpRequest) ([]FileOpResult, error) {
+		if len(req.Paths) == 0 {
+			return nil, errors.New("paths required")
+		}
+		mode, err := files.ParseMode(req.Mode)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]FileOpResult, 0, len(req.Paths))
+		for _, p := range req.Paths {
+			result := FileOpResult{Path: p}
+			resolved, err := s.files.Resolve(fullID, p, files.Write)
+			if err == nil {
+				err = s.files.Chmod(ctx, fullID, resolved, mode, req.Recursive)
+			}
+			results = append(results, fileOpResult(result, "", err))
+		}
+		return results, nil
+	})
+}
+
+// fileOps decodes a batch request, runs it against the server and reports
+// each path separately, answering 207 when only some of them failed.
+func (s *Server) fileOps(w http.ResponseWriter, r *http.Request, run func(ctx context.Context, fullID string, req FileOpRequest) ([]FileOpResult, error)) {
+	id := r.PathValue("id")
+
+	var req FileOpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	if len(req.Paths) > maxFileOpPaths || len(req.Items) > maxFileOpPaths {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "at most " + strconv.Itoa(maxFileOpPaths) + " paths per request"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileOpTimeout)
+	defer cancel()
+
+	results, err := run(ctx, fullID, req)
+	if err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := FileOpResponse{Results: results}
+	for _, result := range results {
+		if result.Status == "error" {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+	}
+
+	status := http.StatusOK
+	if resp.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	s.json(w, status, resp)
+}
+
+func fileOpResult(result FileOpResult, target string, err error) FileOpResult {
+	result.Target = target
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = "ok"
+	return result
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+)
+
+type RevisionResponse struct {
+	revisions.Revision
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+type RevisionDiffResponse struct {
+	Path string `json:"path"`
+	From int    `json:"from"`
+	// To is 0 when the diff is against the current file.
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
+
+// revisionTracked reports whether writes to p are versioned: files in a
+// directory named cfg anywhere below the root.
+func revisionTracked(p string) bool {
+	return slices.Contains(strings.Split(filepath.ToSlash(filepath.Dir(p)), "/"), "cfg")
+}
+
+// requestAuthor names the user behind a request for the revision history.
+// File routes don't require a token, so anonymous writes are recorded too.
+func (s *Server) requestAuthor(r *http.Request) string {
+	if user, ok := userFromContext(r.Context()); ok {
+		return user.Name
+	}
+	if user, ok := s.auth.Authenticate(requestToken(r)); ok {
+		return user.Name
+	}
+	return "anonymous"
+}
+
+// recordRevision stores data as the newest revision of p if p is a tracked
+// text file. Failures are logged: history is best effort and never fails
+// the write that triggered it.
+func (s *Server) recordRevision(fullID, p, author, action string, data []byte) {
+	if !revisionTracked(p) {
+		return
+	}
+	if _, _, err := files.DecodeText(data); err != nil {
+		return
+	}
+	if _, _, err := s.revisions.Record(s.serverKey(fullID), p, author, action, data); err != nil {
+		log.Printf("Failed to record revision of %s on %s: %v", p, fullID[:12], err)
+	}
+}
+
+// recordFile reads p back from the container and records it.
+func (s *Server) recordFile(fullID, p, author, action string) {
+	if !revisionTracked(p) {
+		return
+	}
+	file, err := s.files.ReadFile(fullID, p, s.cfg.FilesEditMax)
+	if err != nil {
+		return
+	}
+	s.recordRevision(fullID, p, author, action, file.Data)
+}
+
+// recordBaseline stores the content p has before the panel writes to it.
+// The first write keeps the original file, so even the first change can be
+// diffed and reverted; later ones catch edits made outside the panel. Content
+// equal to the newest revision is not stored again. current is the content
+// already read by the caller, or nil to read it here.
+func (s *Server) recordBaseline(fullID, p string, current *files.File) {
+	if !revisionTracked(p) {
+		return
+	}
+	if current == nil {
+		file, err := s.files.ReadFile(fullID, p, s.cfg.FilesEditMax)
+		if err != nil {
+			return
+		}
+		current = file
+	}
+	action := revisions.ActionExternal
+	if list, err := s.revisions.List(s.serverKey(fullID), p); err != nil {
+		return
+	} else if len(list) == 0 {
+		action = revisions.ActionInitial
+	}
+	s.recordRevision(fullID, p, "", action, current.Data)
+}
+
+func (s *Server) handleListRevisions(w http.ResponseWriter, r *http.Request) {
+	fullID, path, ok := s.revisionPath(w, r, files.Read)
+	if !ok {
+		return
+	}
+	list, err := s.revisions.List(s.serverKey(fullID), path)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, list)
+}
+
+func (s *Server) handleGetRevision(w http.ResponseWriter, r *http.Request) {
+	fullID, path, ok := s.revisionPath(w, r, files.Read)
+	if !ok {
+		return
+	}
+	rev, data, ok := s.lookupRevision(w, fullID, path, r.PathValue("rev"))
+	if !ok {
+		return
+	}
+	content, encoding, err := files.DecodeText(data)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, RevisionResponse{Revision: *rev, Content: content, Encoding: encoding})
+}
+
+// handleDiffRevisions returns a unified diff from revision from to revision
+// to. to defaults to the current file and from to the revision before it,
+// so without parameters the diff shows the last change.
+func (s *Server) handleDiffRevisions(w http.ResponseWriter, r *http.Request) {
+	fullID, path, ok := s.revisionPath(w, r, files.Read)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	resp := RevisionDiffResponse{Path: path}
+	var toData []byte
+	toName := path + " (current)"
+	if to := query.Get("to"); to != "" && to != "current" {
+		rev, data, ok := s.lookupRevision(w, fullID, path, to)
+		if !ok {
+			return
+		}
+		resp.To, toData = rev.ID, data
+		toName = path + " (revision " + strconv.Itoa(rev.ID) + ")"
+	} else {
+		file, err := s.files.ReadFile(fullID, path, s.cfg.FilesEditMax)
+		switch {
+		case errors.Is(err, docker.ErrPathNotFound):
+			// Diff against a deleted file shows everything removed.
+		case err != nil:
+			s.fileError(w, err)
+			return
+		default:
+			toData = file.Data
+		}
+	}
+
+	from := query.Get("from")
+	if from == "" {
+		list, err := s.revisions.List(s.serverKey(fullID), path)
+		if err != nil {
+			s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		current := ""
+		if resp.To == 0 && toData != nil {
+			sum := sha256.Sum256(toData)
+			current = hex.EncodeToString(sum[:])
+		}
+		for _, rev := range list {
+			// Against the current file, skip the revision it still matches.
+			if resp.To == 0 && rev.SHA256 != current || resp.To != 0 && rev.ID < resp.To {
+				from = strconv.Itoa(rev.ID)
+				break
+			}
+		}
+		if from == "" {
+			s.json(w, http.StatusNotFound, map[string]string{"error": revisions.ErrNotFound.Error()})
+			return
+		}
+	}
+	rev, fromData, ok := s.lookupRevision(w, fullID, path, from)
+	if !ok {
+		return
+	}
+	resp.From = rev.ID
+
+	diff, err := revisions.Diff(fromData, toData, path+" (revision "+strconv.Itoa(rev.ID)+")", toName)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	resp.Diff = diff
+	s.json(w, http.StatusOK, resp)
+}
+
+// handleRevertRevision writes the content of a revision back to the file.
+// The revert itself becomes the newest revision.
+func (s *Server) handleRevertRevision(w http.ResponseWriter, r *http.Request) {
+	fullID, path, ok := s.revisionPath(w, r, files.Write)
+	if !ok {
+		return
+	}
+	rev, data, ok := s.lookupRevision(w, fullID, path, r.PathValue("rev"))
+	if !ok {
+		return
+	}
+
+	unlock := s.files.Lock(fullID, path)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileExecTimeout)
+	defer cancel()
+
+	mode := int64(defaultFileMode)
+	var uid, gid int
+	current, err := s.files.ReadFile(fullID, path, s.cfg.FilesEditMax)
+	switch {
+	case err == nil:
+		mode, uid, gid = current.Mode, current.Uid, current.Gid
+	case errors.Is(err, docker.ErrPathNotFound), errors.Is(err, files.ErrTooLarge):
+		current = nil
+		uid, gid, err = s.files.Owner(ctx, fullID, filepath.Dir(path))
+		if err != nil {
+			s.fileError(w, err)
+			return
+		}
+	default:
+		s.fileError(w, err)
+		return
+	}
+
+	if current != nil {
+		s.recordBaseline(fullID, path, current)
+	}
+	if err := s.files.WriteFile(ctx, fullID, path, data, mode, uid, gid); err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.recordRevision(fullID, path, s.requestAuthor(r), revisions.ActionRevert, data)
+
+	etag := files.ETag(data)
+	w.Header().Set("ETag", etag)
+	s.json(w, http.StatusOK, map[string]interface{}{"status": "reverted", "revision": rev.ID, "path": path, "etag": etag})
+}
+
+// revisionPath resolves the path query parameter of a revision request.
+func (s *Server) revisionPath(w http.ResponseWriter, r *http.Request, access files.Access) (string, string, bool) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "path required"})
+		return "", "", false
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return "", "", false
+	}
+
+	path, err = s.files.Resolve(fullID, path, access)
+	if err != nil {
+		s.fileError(w, err)
+		return "", "", false
+	}
+	return fullID, path, true
+}
+
+func (s *Server) lookupRevision(w http.ResponseWriter, fullID, path, id string) (*revisions.Revision, []byte, bool) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid revision"})
+		return nil, nil, false
+	}
+	rev, data, err := s.revisions.Get(s.serverKey(fullID), path, n)
+	if errors.Is(err, revisions.ErrNotFound) {
+		s.json(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return nil, nil, false
+	}
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return nil, nil, false
+	}
+	return rev, data, true
+}
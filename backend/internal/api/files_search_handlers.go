@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/chi2l3s/cloudstrike/internal/files"
+)
+
+const (
+	defaultSearchLimit   = 100
+	maxSearchLimit       = 1000
+	defaultSearchContext = 2
+	maxSearchContext     = 10
+)
+
+// handleSearchFiles finds files below path whose name matches the glob in
+// name, or, when q is set, text files containing q (a regular expression
+// with regex=true). Results stop at limit entries or matching lines and
+// when FILES_SEARCH_TIMEOUT expires.
+func (s *Server) handleSearchFiles(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	query := r.URL.Query()
+
+	opts := files.SearchOptions{
+		Name:       query.Get("name"),
+		Query:      query.Get("q"),
+		Regex:      query.Get("regex") == "true",
+		IgnoreCase: query.Get("ignoreCase") == "true",
+		MaxSize:    s.cfg.FilesEditMax,
+	}
+	if opts.Name == "" && opts.Query == "" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "name or q required"})
+		return
+	}
+
+	var err error
+	opts.Limit, err = queryInt(query.Get("limit"), defaultSearchLimit)
+	if err != nil || opts.Limit <= 0 || opts.Limit > maxSearchLimit {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		return
+	}
+	opts.Context, err = queryInt(query.Get("context"), defaultSearchContext)
+	if err != nil || opts.Context < 0 || opts.Context > maxSearchContext {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid context"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	dir, err := s.files.Resolve(fullID, query.Get("path"), files.Read)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.FilesSearchTimeout)
+	defer cancel()
+
+	result, err := s.files.Search(ctx, fullID, dir, opts)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, result)
+}
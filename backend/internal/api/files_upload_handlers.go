@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+	"github.com/chi2l3s/cloudstrike/internal/uploads"
+)
+
+// Multipart bodies up to this size are kept in memory, the rest is spooled
+// to temporary files by net/http.
+const multipartMemory = 32 << 20
+
+// CreateUploadRequest starts a chunked upload of Name into the directory Path.
+// SHA256 is the optional hex digest of the whole file, checked on completion.
+type CreateUploadRequest struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+// handleUploadFile stores every file of the multipart "file" field in the
+// directory given by path, reporting each one separately.
+func (s *Server) handleUploadFile(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	dir, err := s.files.Resolve(fullID, r.URL.Query().Get("path"), files.Read)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart form"})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "file required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileOpTimeout)
+	defer cancel()
+
+	uid, gid, err := s.files.Owner(ctx, fullID, dir)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	overwrite := r.URL.Query().Get("overwrite") != "false"
+	resp := FileOpResponse{Results: make([]FileOpResult, 0, len(headers))}
+	for _, header := range headers {
+		result := FileOpResult{Path: header.Filename}
+		target, err := s.uploadTarget(fullID, dir, header.Filename, overwrite)
+		if err == nil {
+			file, openErr := header.Open()
+			if err = openErr; err == nil {
+				s.recordBaseline(fullID, target, nil)
+				err = s.files.WriteFileFrom(ctx, fullID, target, file, header.Size, defaultFileMode, uid, gid)
+				file.Close()
+			}
+			if err == nil {
+				s.recordFile(fullID, target, s.requestAuthor(r), revisions.ActionUpload)
+			}
+		}
+		result = fileOpResult(result, target, err)
+		if err != nil {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	status := http.StatusOK
+	if resp.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	s.json(w, status, resp)
+}
+
+// uploadTarget resolves where a file named name is stored in dir.
+func (s *Server) uploadTarget(fullID, dir, name string, overwrite bool) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		return "", errors.New("invalid file name")
+	}
+	target, err := s.files.Resolve(fullID, filepath.Join(dir, name), files.Write)
+	if err != nil {
+		return "", err
+	}
+	if err := s.files.CheckTarget(fullID, target, overwrite); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func (s *Server) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req CreateUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	if req.Name == "" || req.Size < 0 {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "name and size required"})
+		return
+	}
+	if s.cfg.UploadMaxSize > 0 && req.Size > s.cfg.UploadMaxSize {
+		s.fileError(w, files.ErrTooLarge)
+		return
+	}
+	if req.SHA256 != "" {
+		if sum, err := hex.DecodeString(req.SHA256); err != nil || len(sum) != 32 {
+			s.json(w, http.StatusBadRequest, map[string]string{"error": "sha256 must be 64 hex characters"})
+			return
+		}
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	dir, err := s.files.Resolve(fullID, req.Path, files.Read)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	target, err := s.uploadTarget(fullID, dir, req.Name, req.Overwrite)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	serverID, err := s.serverID(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	upload, err := s.uploads.Create(serverID, target, req.Size, req.SHA256, req.Overwrite)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusCreated, upload)
+}
+
+func (s *Server) handleGetUpload(w http.ResponseWriter, r *http.Request) {
+	upload, _, ok := s.lookupUpload(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	s.json(w, http.StatusOK, upload)
+}
+
+// handleUploadChunk appends the request body at the offset given in the
+// Upload-Offset header. X-Chunk-SHA256 optionally verifies the chunk. The
+// upload is completed as soon as the last byte arrives.
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	upload, fullID, ok := s.lookupUpload(w, r)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "Upload-Offset header required"})
+		return
+	}
+
+	upload, err = s.uploads.Append(upload.ID, offset, r.Body, r.Header.Get("X-Chunk-SHA256"))
+	if upload != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+	if err != nil {
+		s.uploadError(w, upload, err)
+		return
+	}
+
+	if upload.Offset < upload.Size {
+		s.json(w, http.StatusOK, upload)
+		return
+	}
+	s.completeUpload(w, r, fullID, upload)
+}
+
+// handleCompleteUpload retries the final copy of a fully received upload.
+func (s *Server) handleCompleteUpload(w http.ResponseWriter, r *http.Request) {
+	upload, fullID, ok := s.lookupUpload(w, r)
+	if !ok {
+		return
+	}
+	s.completeUpload(w, r, fullID, upload)
+}
+
+func (s *Server) handleCancelUpload(w http.ResponseWriter, r *http.Request) {
+	upload, _, ok := s.lookupUpload(w, r)
+	if !ok {
+		return
+	}
+	s.uploads.Remove(upload.ID)
+	s.json(w, http.StatusOK, map[string]string{"status": "cancelled"})
+}
+
+// completeUpload verifies the staged file and atomically moves it into the
+// server's current container. On failure the staged data is kept so the
+// client can retry.
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, fullID string, upload *uploads.Upload) {
+	unlock := s.uploads.Lock(upload.ID)
+	defer unlock()
+
+	upload, file, err := s.uploads.Open(upload.ID)
+	if errors.Is(err, uploads.ErrChecksum) {
+		// The staged data is unusable; the client has to start over.
+		s.uploads.Remove(upload.ID)
+	}
+	if err != nil {
+		s.uploadError(w, upload, err)
+		return
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileOpTimeout)
+	defer cancel()
+
+	// The tree may have changed since the upload started.
+	target, err := s.files.Resolve(fullID, upload.Path, files.Write)
+	if err == nil {
+		err = s.files.CheckTarget(fullID, target, upload.Overwrite)
+	}
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	uid, gid, err := s.files.Owner(ctx, fullID, filepath.Dir(target))
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.recordBaseline(fullID, target, nil)
+	if err := s.files.WriteFileFrom(ctx, fullID, target, file, upload.Size, defaultFileMode, uid, gid); err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.recordFile(fullID, target, s.requestAuthor(r), revisions.ActionUpload)
+
+	s.uploads.Remove(upload.ID)
+	s.json(w, http.StatusOK, map[string]interface{}{"status": "completed", "path": target, "size": upload.Size})
+}
+
+// lookupUpload finds the upload named in the URL, which must belong to the
+// server named there, and returns it with the server's current container.
+func (s *Server) lookupUpload(w http.ResponseWriter, r *http.Request) (*uploads.Upload, string, bool) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return nil, "", false
+	}
+	serverID, err := s.serverID(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return nil, "", false
+	}
+
+	upload, err := s.uploads.Get(r.PathValue("uploadId"))
+	// Uploads staged before they were keyed by server ID name the container.
+	if err == nil && upload.ServerID != serverID && upload.ServerID != fullID {
+		err = uploads.ErrNotFound
+	}
+	if err != nil {
+		s.uploadError(w, upload, err)
+		return nil, "", false
+	}
+	return upload, fullID, true
+}
+
+func (s *Server) uploadError(w http.ResponseWriter, upload *uploads.Upload, err error) {
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		s.json(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, uploads.ErrOffsetMismatch), errors.Is(err, uploads.ErrIncomplete):
+		s.json(w, http.StatusConflict, map[string]interface{}{"error": err.Error(), "upload": upload})
+	case errors.Is(err, uploads.ErrTooLarge):
+		s.json(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	case errors.Is(err, uploads.ErrChecksum):
+		s.json(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "upload": upload})
+	default:
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -2,21 +2,30 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
-	"strings"
+	"regexp"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/jobs"
 )
 
 type CreateServerRequest struct {
-	Name         string `json:"name"`
-	Port         string `json:"port"`
-	RconPassword string `json:"rconPassword"`
+	Name         string   `json:"name"`
+	Port         string   `json:"port"`
+	RconPassword string   `json:"rconPassword"`
+	Tags         []string `json:"tags"`
 }
 
 type ServerResponse struct {
-	ID     string `json:"id"`
-	Name   string `json:"name"`
-	Port   string `json:"port"`
-	Status string `json:"status"`
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Port   string   `json:"port"`
+	Status string   `json:"status"`
+	Tags   []string `json:"tags"`
 }
 
 func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
@@ -30,10 +39,11 @@ func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
 	for _, c := range containers {
 		if c.Labels["cloudstrike"] == "true" {
 			servers = append(servers, ServerResponse{
-				ID:     c.ID[:12],
+				ID:     docker.ServerID(c.ID, c.Labels),
 				Name:   c.Labels["cloudstrike.name"],
 				Port:   c.Labels["cloudstrike.port"],
 				Status: c.State,
+				Tags:   docker.ServerTags(c.Labels),
 			})
 		}
 	}
@@ -52,13 +62,41 @@ func (s *Server) handleCreateServer(w http.ResponseWriter, r *http.Request) {
 		s.json(w, http.StatusBadRequest, map[string]string{"error": "name and port required"})
 		return
 	}
+	if !validServerName(req.Name) {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": errServerName.Error()})
+		return
+	}
 
 	if req.RconPassword == "" {
 		s.json(w, http.StatusBadRequest, map[string]string{"error": "rcon password required"})
 		return
 	}
 
-	id, err := s.docker.CreateGameServer(req.Name, req.Port, req.RconPassword)
+	for _, tag := range req.Tags {
+		if !validTag(tag) {
+			s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid tag: " + tag})
+			return
+		}
+	}
+
+	settings := defaultSettings()
+	settings.ServerName = req.Name
+	settings.RconPassword = req.RconPassword
+	env, err := s.serverEnv(req.Name, settings)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	id, err := s.docker.CreateGameServer(docker.GameServerSpec{
+		Name:         req.Name,
+		Port:         req.Port,
+		RconPassword: req.RconPassword,
+		Template:     files.DefaultTemplate,
+		Tags:         req.Tags,
+		DataDir:      s.cfg.FilesRoot,
+		Env:          env,
+	})
 	if err != nil {
 		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
@@ -71,15 +109,11 @@ func (s *Server) handleCreateServer(w http.ResponseWriter, r *http.Request) {
 
 	// Save RCON password to settings
 	shortID := id[:12]
-	settingsStore[shortID] = &ServerSettings{
-		ServerName:   req.Name,
-		MaxPlayers:   10,
-		Map:          "de_dust2",
-		Tickrate:     128,
-		RconPassword: req.RconPassword,
-		SvPassword:   "",
-		GameMode:     "1",
-		GameType:     "0",
+	putSettings(req.Name, settings)
+
+	tags := req.Tags
+	if tags == nil {
+		tags = []string{}
 	}
 
 	s.json(w, http.StatusCreated, ServerResponse{
@@ -87,43 +121,88 @@ func (s *Server) handleCreateServer(w http.ResponseWriter, r *http.Request) {
 		Name:   req.Name,
 		Port:   req.Port,
 		Status: "running",
+		Tags:   tags,
 	})
 }
 
 func (s *Server) handleStartServer(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
-	containers, _ := s.docker.ListContainers()
-	for _, c := range containers {
-		if strings.HasPrefix(c.ID, id) {
-			if err := s.docker.StartContainer(c.ID); err != nil {
-				s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
-				return
-			}
-			s.json(w, http.StatusOK, map[string]string{"status": "started"})
-			return
-		}
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
 	}
 
-	s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+	if _, _, err := s.startServer(fullID); err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, map[string]string{"status": "started"})
 }
 
 func (s *Server) handleStopServer(w http.ResponseWriter, r *http.Request) {
+	s.stopOrRestart(w, r, false)
+}
+
+func (s *Server) handleRestartServer(w http.ResponseWriter, r *http.Request) {
+	s.stopOrRestart(w, r, true)
+}
+
+func (s *Server) stopOrRestart(w http.ResponseWriter, r *http.Request, restart bool) {
 	id := r.PathValue("id")
 
-	containers, _ := s.docker.ListContainers()
-	for _, c := range containers {
-		if strings.HasPrefix(c.ID, id) {
-			if err := s.docker.StopContainer(c.ID); err != nil {
-				s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
-				return
-			}
-			s.json(w, http.StatusOK, map[string]string{"status": "stopped"})
+	req, err := decodeStopRequest(r)
+	if err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	job, err := s.stopServer(id, fullID, req, restart)
+	if job != nil {
+		if err != nil {
+			s.json(w, http.StatusConflict, map[string]interface{}{"error": err.Error(), "job": job})
 			return
 		}
+		s.json(w, http.StatusAccepted, map[string]interface{}{"status": job.Kind + " scheduled", "job": job})
+		return
+	}
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
 	}
 
-	s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+	status := "stopped"
+	if restart {
+		status = "restarted"
+	}
+	s.json(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// stopServer stops or restarts a server right away, or schedules the graceful
+// flow and returns its job.
+func (s *Server) stopServer(id, fullID string, req StopRequest, restart bool) (*jobs.Job, error) {
+	plan := s.stopPlan(req, restart)
+
+	if req.Graceful {
+		return s.startGracefulStop(id, fullID, plan)
+	}
+
+	s.rcon.Disconnect(id)
+	if err := s.docker.StopContainer(fullID, plan.stopTimeout); err != nil {
+		return nil, err
+	}
+	if restart {
+		_, _, err := s.startServer(fullID)
+		return nil, err
+	}
+	return nil, nil
 }
 
 func (s *Server) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
@@ -131,8 +210,8 @@ func (s *Server) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
 
 	containers, _ := s.docker.ListContainers()
 	for _, c := range containers {
-		if strings.HasPrefix(c.ID, id) {
-			if err := s.docker.RemoveContainer(c.ID); err != nil {
+		if docker.MatchesServerID(c.ID, c.Labels, id) {
+			if err := s.deleteServer(c.ID, r.URL.Query().Get("deleteData") == "true"); err != nil {
 				s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 				return
 			}
@@ -143,3 +222,86 @@ func (s *Server) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
 
 	s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
 }
+
+// serverKey names the data the panel keeps about a server, such as file
+// history and workshop content, after the server rather than its container,
+// so it survives re-creating the container.
+func (s *Server) serverKey(fullID string) string {
+	labels, err := s.docker.ContainerLabels(fullID)
+	if err != nil || labels["cloudstrike.name"] == "" {
+		return fullID
+	}
+	return labels["cloudstrike.name"]
+}
+
+// serverID returns the short ID of a server. It stays the same when the
+// container is re-created, so staged uploads and jobs stay with the server
+// across a restart that applies pending settings.
+func (s *Server) serverID(fullID string) (string, error) {
+	labels, err := s.docker.ContainerLabels(fullID)
+	if err != nil {
+		return "", err
+	}
+	return docker.ServerID(fullID, labels), nil
+}
+
+// deleteServer removes the container. The volume holding its files, their
+// revision history, the workshop config and the map rotation are kept, so a
+// server created again under the same name picks them up, unless deleteData
+// is set.
+func (s *Server) deleteServer(fullID string, deleteData bool) error {
+	labels, err := s.docker.ContainerLabels(fullID)
+	if err != nil {
+		return err
+	}
+	key := s.serverKey(fullID)
+	if err := s.docker.RemoveContainer(fullID); err != nil {
+		return err
+	}
+	shortID := docker.ServerID(fullID, labels)
+	s.rcon.Disconnect(shortID)
+	deleteSettings(key)
+
+	if !deleteData {
+		return nil
+	}
+	if err := s.revisions.RemoveServer(key); err != nil {
+		log.Printf("Failed to remove file history of %s: %v", shortID, err)
+	}
+	if err := s.workshop.Remove(key); err != nil {
+		log.Printf("Failed to remove workshop config of %s: %v", shortID, err)
+	}
+	if err := s.rotations.RemoveRotation(key); err != nil {
+		log.Printf("Failed to remove map rotation of %s: %v", shortID, err)
+	}
+	if vol := labels["cloudstrike.volume"]; vol != "" {
+		if err := s.docker.RemoveVolume(vol); err != nil {
+			return fmt.Errorf("server deleted, but removing its data volume failed: %w", err)
+		}
+	}
+	return nil
+}
+
+var (
+	serverNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,62}$`)
+	errServerName     = errors.New("server names are 1-63 letters, digits, - and _, starting with a letter or digit")
+)
+
+// validServerName accepts names that are safe as container and volume names
+// and as keys of the per-server data in DATA_DIR.
+func validServerName(name string) bool {
+	return serverNamePattern.MatchString(name)
+}
+
+// validTag accepts short labels safe to store comma-separated in a Docker label.
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > 32 {
+		return false
+	}
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/chi2l3s/cloudstrike/internal/jobs"
+)
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := s.jobServerID(w, r)
+	if !ok {
+		return
+	}
+	s.json(w, http.StatusOK, s.jobs.List(serverID))
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	s.json(w, http.StatusOK, job)
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	s.jobs.Cancel(job.ID)
+	s.json(w, http.StatusOK, map[string]string{"status": "cancelling"})
+}
+
+// jobServerID resolves the {id} path value to the ID jobs of the server are
+// listed under, writing the error response if it can't.
+func (s *Server) jobServerID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return "", false
+	}
+	serverID, err := s.serverID(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return "", false
+	}
+	return serverID, true
+}
+
+// lookupJob finds the {jobId} job, answering 404 for jobs of other servers
+// so a user can't reach them through a server they have access to.
+func (s *Server) lookupJob(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	serverID, ok := s.jobServerID(w, r)
+	if !ok {
+		return jobs.Job{}, false
+	}
+	job, ok := s.jobs.Get(r.PathValue("jobId"))
+	if !ok || job.ServerID != serverID {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "job not found"})
+		return jobs.Job{}, false
+	}
+	return job, true
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/jobs"
+	"github.com/chi2l3s/cloudstrike/internal/rcon"
+)
+
+// StopRequest is the optional body of the stop and restart endpoints.
+// Unset fields fall back to the STOP_* settings of the panel.
+type StopRequest struct {
+	Graceful               bool     `json:"graceful"`
+	CountdownSeconds       *int     `json:"countdownSeconds"`
+	WarnAt                 []int    `json:"warnAt"`
+	Reason                 string   `json:"reason"`
+	WaitForMatchEnd        bool     `json:"waitForMatchEnd"`
+	MatchEndTimeoutSeconds int      `json:"matchEndTimeoutSeconds"`
+	PreStopCommands        []string `json:"preStopCommands"`
+	StopTimeoutSeconds     int      `json:"stopTimeoutSeconds"`
+}
+
+type stopPlan struct {
+	restart         bool
+	countdown       time.Duration
+	warnAt          []int
+	reason          string
+	waitForMatchEnd bool
+	matchEndTimeout time.Duration
+	preStopCommands []string
+	stopTimeout     time.Duration
+}
+
+const (
+	jobKindStop    = "stop"
+	jobKindRestart = "restart"
+)
+
+// Matches the line srcds prints when a match finishes.
+var gameOverLine = regexp.MustCompile(`Game Over:`)
+
+func decodeStopRequest(r *http.Request) (StopRequest, error) {
+	var req StopRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return req, err
+	}
+	return req, nil
+}
+
+func (s *Server) stopPlan(req StopRequest, restart bool) stopPlan {
+	plan := stopPlan{
+		restart:         restart,
+		countdown:       s.cfg.StopCountdown,
+		warnAt:          s.cfg.StopWarnAt,
+		reason:          req.Reason,
+		waitForMatchEnd: req.WaitForMatchEnd,
+		matchEndTimeout: s.cfg.StopMatchEndTimeout,
+		preStopCommands: s.cfg.StopPreCommands,
+		stopTimeout:     s.cfg.StopTimeout,
+	}
+	if req.CountdownSeconds != nil {
+		plan.countdown = time.Duration(*req.CountdownSeconds) * time.Second
+	}
+	if req.WarnAt != nil {
+		plan.warnAt = req.WarnAt
+	}
+	if req.MatchEndTimeoutSeconds > 0 {
+		plan.matchEndTimeout = time.Duration(req.MatchEndTimeoutSeconds) * time.Second
+	}
+	if req.PreStopCommands != nil {
+		plan.preStopCommands = req.PreStopCommands
+	}
+	if req.StopTimeoutSeconds > 0 {
+		plan.stopTimeout = time.Duration(req.StopTimeoutSeconds) * time.Second
+	}
+	return plan
+}
+
+// startGracefulStop runs the stop or restart flow as a job, refusing to start
+// a second one while another is in progress for the same server; the error
+// then comes with the job already running.
+func (s *Server) startGracefulStop(serverID, fullID string, plan stopPlan) (*jobs.Job, error) {
+	kind := jobKindStop
+	if plan.restart {
+		kind = jobKindRestart
+	}
+
+	// Jobs are listed under the server ID rather than the prefix the
+	// request used, so every stop of the server is seen as the same one.
+	jobServerID, err := s.serverID(fullID)
+	if err != nil {
+		return nil, err
+	}
+	job, started := s.jobs.StartUnique(kind, jobServerID, []string{jobKindStop, jobKindRestart}, func(ctx context.Context, rep jobs.Reporter) error {
+		return s.gracefulStop(ctx, rep, serverID, fullID, plan)
+	})
+	if !started {
+		return &job, fmt.Errorf("a %s is already in progress", job.Kind)
+	}
+	return &job, nil
+}
+
+func (s *Server) gracefulStop(ctx context.Context, rep jobs.Reporter, serverID, fullID string, plan stopPlan) error {
+	if err := s.ensureRCON(serverID, fullID); err != nil {
+		rep.Report(0, "RCON unavailable, stopping without warnings: "+err.Error())
+	} else {
+		if plan.waitForMatchEnd {
+			rep.Report(0, "waiting for the match to end")
+			if err := s.waitForMatchEnd(ctx, serverID, fullID, plan.matchEndTimeout); err != nil {
+				return err
+			}
+		}
+
+		if err := s.countdown(ctx, rep, serverID, plan); err != nil {
+			return err
+		}
+
+		for _, cmd := range plan.preStopCommands {
+			rep.Report(85, "running "+cmd)
+			if _, err := s.rcon.Execute(serverID, cmd); err != nil {
+				log.Printf("Pre-stop command %q on %s failed: %v", cmd, serverID, err)
+			}
+		}
+	}
+
+	rep.Report(90, "stopping container")
+	s.rcon.Disconnect(serverID)
+	if err := s.docker.StopContainer(fullID, plan.stopTimeout); err != nil {
+		return err
+	}
+
+	if plan.restart {
+		rep.Report(95, "starting container")
+		if _, _, err := s.startServer(fullID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countdown announces the remaining time in chat at each warnAt mark.
+func (s *Server) countdown(ctx context.Context, rep jobs.Reporter, serverID string, plan stopPlan) error {
+	total := int(plan.countdown.Seconds())
+	if total <= 0 {
+		return nil
+	}
+
+	warnAt := make(map[int]bool, len(plan.warnAt))
+	for _, sec := range plan.warnAt {
+		warnAt[sec] = true
+	}
+
+	verb := "shutting down"
+	if plan.restart {
+		verb = "restarting"
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for remaining := total; remaining > 0; remaining-- {
+		if remaining == total || warnAt[remaining] {
+			msg := fmt.Sprintf("Server is %s in %s", verb, formatSeconds(remaining))
+			if plan.reason != "" {
+				msg += ": " + plan.reason
+			}
+			if _, err := s.rcon.Execute(serverID, "say "+msg); err != nil {
+				log.Printf("Countdown announcement on %s failed: %v", serverID, err)
+			}
+		}
+		rep.Report(80*float64(total-remaining)/float64(total), fmt.Sprintf("%s in %ds", verb, remaining))
+
+		select {
+		case <-ctx.Done():
+			s.rcon.Execute(serverID, "say Server "+verbNoun(plan.restart)+" cancelled")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// waitForMatchEnd blocks until srcds reports game over, the server empties
+// or timeout passes. Only cancellation of ctx is treated as an error.
+func (s *Server) waitForMatchEnd(ctx context.Context, serverID, fullID string, timeout time.Duration) error {
+	if s.serverIsEmpty(serverID) {
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logs, err := s.docker.FollowLogs(waitCtx, fullID, time.Now())
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	gameOver := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(logs)
+		for scanner.Scan() {
+			if gameOverLine.MatchString(scanner.Text()) {
+				close(gameOver)
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gameOver:
+			return nil
+		case <-ticker.C:
+			if s.serverIsEmpty(serverID) {
+				return nil
+			}
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Match on %s still running after %s, stopping anyway", serverID, timeout)
+			return nil
+		}
+	}
+}
+
+func (s *Server) serverIsEmpty(serverID string) bool {
+	output, err := s.rcon.Execute(serverID, "status")
+	if err != nil {
+		return false
+	}
+	status, ok := rcon.ParseStatus(output)
+	return ok && status.Players == 0
+}
+
+func verbNoun(restart bool) string {
+	if restart {
+		return "restart"
+	}
+	return "shutdown"
+}
+
+func formatSeconds(sec int) string {
+	switch {
+	case sec == 60:
+		return "1 minute"
+	case sec >= 60 && sec%60 == 0:
+		return fmt.Sprintf("%d minutes", sec/60)
+	case sec == 1:
+		return "1 second"
+	default:
+		return fmt.Sprintf("%d seconds", sec)
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/metrics"
+	"github.com/chi2l3s/cloudstrike/internal/rcon"
+)
+
+const (
+	// Upper bound on concurrent Docker stats calls made during one scrape.
+	metricsScrapeConcurrency = 8
+	// How long server samples are reused between scrapes. Each sample runs
+	// status over the RCON connection the console shares.
+	metricsSampleMaxAge = 30 * time.Second
+)
+
+func (s *Server) registerMetrics() {
+	metrics.RegisterRCONConnections(s.rcon.Count)
+	metrics.RegisterServerCollector(s.collectServerSamples, 10*time.Second, metricsSampleMaxAge)
+}
+
+func (s *Server) collectServerSamples(ctx context.Context) ([]metrics.ServerSample, error) {
+	containers, err := s.docker.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		samples []metrics.ServerSample
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, metricsScrapeConcurrency)
+	)
+
+	for _, c := range containers {
+		if c.Labels["cloudstrike"] != "true" {
+			continue
+		}
+
+		shortID := docker.ServerID(c.ID, c.Labels)
+		sample := metrics.ServerSample{
+			ID:            shortID,
+			Name:          c.Labels["cloudstrike.name"],
+			Up:            c.State == "running",
+			RCONConnected: s.rcon.IsConnected(shortID),
+		}
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			// A server the scrape ran out of time for is still reported,
+			// just without stats.
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				mu.Lock()
+				samples = append(samples, sample)
+				mu.Unlock()
+				return
+			}
+
+			if stats, err := s.docker.GetContainerStats(id); err == nil {
+				sample.CPU = stats.CPU
+				sample.Memory = stats.Memory
+				sample.MemoryLimit = stats.MemoryLimit
+				sample.NetworkRx = stats.NetworkRx
+				sample.NetworkTx = stats.NetworkTx
+				sample.RestartCount = stats.RestartCount
+			}
+
+			if sample.Up && sample.RCONConnected {
+				if output, err := s.rcon.Execute(shortID, "status"); err == nil {
+					if status, ok := rcon.ParseStatus(output); ok {
+						sample.Players = status.Players
+						sample.PlayersKnown = true
+					}
+				}
+			}
+
+			mu.Lock()
+			samples = append(samples, sample)
+			mu.Unlock()
+		}(c.ID)
+	}
+
+	wg.Wait()
+	return samples, nil
+}
+
+// metricsHandler serves the metrics to scrapers presenting the metrics token.
+func (s *Server) metricsHandler() http.Handler {
+	h := metrics.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(requestToken(r)), []byte(s.cfg.MetricsToken)) != 1 {
+			s.json(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// metricsMiddleware records request latency labelled with the mux pattern
+// that served the request, so path parameters don't explode cardinality.
+func (s *Server) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if r.Pattern != "" {
+			route = r.Pattern
+			if i := strings.IndexByte(route, ' '); i >= 0 {
+				route = route[i+1:]
+			}
+		}
+		metrics.ObserveHTTPRequest(route, r.Method, rec.status, time.Since(start))
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/chi2l3s/cloudstrike/internal/presets"
+)
+
+// SavePresetRequest is a custom preset. With FromServer set, the game mode,
+// map group, map and cvars are taken from that server's settings instead.
+type SavePresetRequest struct {
+	presets.Preset
+	FromServer string `json:"fromServer,omitempty"`
+}
+
+// SettingChange is one setting a preset would change.
+type SettingChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type PresetPreviewResponse struct {
+	Preset   string          `json:"preset"`
+	Changes  []SettingChange `json:"changes"`
+	Settings *ServerSettings `json:"settings"`
+}
+
+type PresetApplyResponse struct {
+	*SettingsResponse
+	Preset  string          `json:"preset"`
+	Changes []SettingChange `json:"changes"`
+}
+
+func (s *Server) handleListPresets(w http.ResponseWriter, r *http.Request) {
+	list, err := s.presets.List()
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, list)
+}
+
+func (s *Server) handleGetPreset(w http.ResponseWriter, r *http.Request) {
+	p, err := s.presets.Get(r.PathValue("name"))
+	if err != nil {
+		s.presetError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, p)
+}
+
+// handleSavePreset creates or replaces a custom preset. Its fields are
+// validated like server settings; built-in presets can't be replaced.
+func (s *Server) handleSavePreset(w http.ResponseWriter, r *http.Request) {
+	var req SavePresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	p := req.Preset
+	p.Name = r.PathValue("name")
+
+	if req.FromServer != "" {
+		fullID, err := s.docker.GetContainerByPrefix(req.FromServer)
+		if err != nil || fullID == "" {
+			s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+			return
+		}
+		settings, err := s.serverSettings(fullID)
+		if err != nil {
+			s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.GameType = settings.GameType
+		p.GameMode = settings.GameMode
+		p.MapGroup = settings.MapGroup
+		p.Map = settings.Map
+		p.Cvars = settings.Cvars
+	}
+
+	if err := validatePreset(&p); err != nil {
+		s.settingsError(w, err)
+		return
+	}
+	if err := s.presets.Save(p); err != nil {
+		s.presetError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, p)
+}
+
+func (s *Server) handleDeletePreset(w http.ResponseWriter, r *http.Request) {
+	if err := s.presets.Delete(r.PathValue("name")); err != nil {
+		s.presetError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handlePreviewPreset shows what applying a preset would change in the
+// server's settings without changing anything.
+func (s *Server) handlePreviewPreset(w http.ResponseWriter, r *http.Request) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+	p, err := s.presets.Get(r.PathValue("name"))
+	if err != nil {
+		s.presetError(w, err)
+		return
+	}
+
+	prev, err := s.serverSettings(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	next := presetSettings(prev, p, r.URL.Query().Get("keepCvars") == "true")
+	if err := validateSettings(next); err != nil {
+		s.settingsError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, PresetPreviewResponse{
+		Preset:   p.Name,
+		Changes:  diffSettings(prev, next),
+		Settings: next,
+	})
+}
+
+// handleApplyPreset applies a preset to the server's settings in one step.
+// Like a settings update, fields that can't change live wait for the next
+// restart, or trigger one right away with ?restart=true.
+func (s *Server) handleApplyPreset(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+	p, err := s.presets.Get(r.PathValue("name"))
+	if err != nil {
+		s.presetError(w, err)
+		return
+	}
+
+	prev, err := s.serverSettings(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	next := presetSettings(prev, p, r.URL.Query().Get("keepCvars") == "true")
+	resp, err := s.applySettings(id, fullID, s.requestAuthor(r), next)
+	if err != nil {
+		s.settingsError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("restart") == "true" {
+		if err := s.restartForPending(id, fullID, resp); err != nil {
+			s.json(w, http.StatusInternalServerError, map[string]string{"error": "preset applied, but the restart failed: " + err.Error()})
+			return
+		}
+	}
+
+	s.json(w, http.StatusOK, PresetApplyResponse{
+		SettingsResponse: resp,
+		Preset:           p.Name,
+		Changes:          diffSettings(prev, next),
+	})
+}
+
+// presetSettings returns settings with the preset applied. The preset's
+// cvars replace the extra cvars, so applying another preset leaves nothing
+// of the previous one behind, unless keepCvars merges them instead.
+func presetSettings(settings *ServerSettings, p *presets.Preset, keepCvars bool) *ServerSettings {
+	next := *settings
+	next.GameType = p.GameType
+	next.GameMode = p.GameMode
+	if p.MapGroup != "" {
+		next.MapGroup = p.MapGroup
+	}
+	if p.Map != "" {
+		next.Map = p.Map
+	}
+	next.Cvars = maps.Clone(p.Cvars)
+	if keepCvars {
+		next.Cvars = maps.Clone(settings.Cvars)
+		maps.Copy(next.Cvars, p.Cvars)
+	}
+	if next.Cvars == nil {
+		next.Cvars = map[string]string{}
+	}
+	return &next
+}
+
+// validatePreset checks a preset the way its settings would be checked and
+// brings its values into canonical form.
+func validatePreset(p *presets.Preset) error {
+	base := defaultSettings()
+	// Presets leave the password alone; any value passes here.
+	base.RconPassword = "preset"
+	settings := presetSettings(base, p, false)
+	if err := validateSettings(settings); err != nil {
+		return err
+	}
+	p.GameType = settings.GameType
+	p.GameMode = settings.GameMode
+	if p.MapGroup != "" {
+		p.MapGroup = settings.MapGroup
+	}
+	if p.Map != "" {
+		p.Map = settings.Map
+	}
+	p.Cvars = settings.Cvars
+	return nil
+}
+
+// diffSettings lists the fields and extra cvars that differ between prev and
+// next. Passwords are reported as changed without their values.
+func diffSettings(prev, next *ServerSettings) []SettingChange {
+	changes := []SettingChange{}
+	for _, f := range settingFields {
+		from, to := f.get(prev), f.get(next)
+		if from == to {
+			continue
+		}
+		if f.name == "rconPassword" || f.name == "svPassword" {
+			from, to = "********", "********"
+		}
+		changes = append(changes, SettingChange{Field: f.name, From: from, To: to})
+	}
+	names := slices.Sorted(maps.Keys(prev.Cvars))
+	for name := range next.Cvars {
+		if _, ok := prev.Cvars[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		from, to := prev.Cvars[name], next.Cvars[name]
+		if from != to {
+			changes = append(changes, SettingChange{Field: "cvars." + name, From: from, To: to})
+		}
+	}
+	return changes
+}
+
+// presetError writes the response for a failed preset store call.
+func (s *Server) presetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, presets.ErrNotFound):
+		s.json(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, presets.ErrBuiltIn):
+		s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, presets.ErrName):
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/chi2l3s/cloudstrike/internal/presets"
+)
+
+// TestBuiltInPresets checks the shipped presets against the cvar schema
+// under the default configuration, so applying one never fails validation.
+func TestBuiltInPresets(t *testing.T) {
+	store, err := presets.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Fatal("no built-in presets")
+	}
+	for _, p := range list {
+		t.Run(p.Name, func(t *testing.T) {
+			if !p.BuiltIn {
+				t.Fatalf("preset %s is not built in", p.Name)
+			}
+			got := p
+			got.Cvars = maps.Clone(p.Cvars)
+			if err := validatePreset(&got); err != nil {
+				t.Fatalf("validatePreset: %v", err)
+			}
+			// Values must already be canonical, or the preset would differ
+			// from the settings it produces.
+			if got.GameType != p.GameType || got.GameMode != p.GameMode || got.MapGroup != p.MapGroup || got.Map != p.Map {
+				t.Errorf("validatePreset = %+v, want %+v", got, p)
+			}
+			if !maps.Equal(got.Cvars, p.Cvars) {
+				t.Errorf("validatePreset cvars = %v, want %v", got.Cvars, p.Cvars)
+			}
+		})
+	}
+}
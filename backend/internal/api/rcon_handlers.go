@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 )
 
@@ -35,28 +36,9 @@ func (s *Server) handleRCONConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Try to get container IP for direct connection
 	address := req.Address
 	if address == "" || address == "localhost:27015" {
-		// Try container IP first (for docker-to-docker or host-to-container via bridge)
-		containerIP, err := s.docker.GetContainerIP(fullID)
-		if err == nil && containerIP != "" {
-			// Get the port from container labels or use default
-			containers, _ := s.docker.ListContainers()
-			port := "27015"
-			for _, c := range containers {
-				if c.ID == fullID {
-					if p, ok := c.Labels["cloudstrike.port"]; ok {
-						port = p
-					}
-					break
-				}
-			}
-			address = containerIP + ":" + port
-		} else {
-			// Fallback to localhost with mapped port
-			address = "127.0.0.1:27015"
-		}
+		address = s.rconAddress(fullID)
 	}
 
 	if err := s.rcon.Connect(serverID, address, req.Password); err != nil {
@@ -101,3 +83,44 @@ func (s *Server) handleRCONStatus(w http.ResponseWriter, r *http.Request) {
 	connected := s.rcon.IsConnected(serverID)
 	s.json(w, http.StatusOK, map[string]bool{"connected": connected})
 }
+
+// rconAddress picks the address the panel should dial to reach a server's RCON.
+func (s *Server) rconAddress(fullID string) string {
+	// Try container IP first (for docker-to-docker or host-to-container via bridge)
+	containerIP, err := s.docker.GetContainerIP(fullID)
+	if err != nil || containerIP == "" {
+		// Fallback to localhost with mapped port
+		return "127.0.0.1:27015"
+	}
+
+	// Get the port from container labels or use default
+	containers, _ := s.docker.ListContainers()
+	port := "27015"
+	for _, c := range containers {
+		if c.ID == fullID {
+			if p, ok := c.Labels["cloudstrike.port"]; ok {
+				port = p
+			}
+			break
+		}
+	}
+	return containerIP + ":" + port
+}
+
+// ensureRCON connects to the server with its stored RCON password unless a
+// connection is already open.
+func (s *Server) ensureRCON(serverID, fullID string) error {
+	if s.rcon.IsConnected(serverID) {
+		return nil
+	}
+
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		return err
+	}
+	if settings.RconPassword == "" {
+		return fmt.Errorf("no RCON password stored for server %s", serverID)
+	}
+
+	return s.rcon.Connect(serverID, s.rconAddress(fullID), settings.RconPassword)
+}
@@ -0,0 +1,594 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/rcon"
+	"github.com/chi2l3s/cloudstrike/internal/rotation"
+)
+
+// gameModesServer holds the mapgroups of the map pools, relative to
+// FILES_ROOT.
+const gameModesServer = "game/csgo/gamemodes_server.txt"
+
+var (
+	errNoRotation         = errors.New("no map rotation configured")
+	errNotRunning         = errors.New("server is not running")
+	errUnmanagedGameModes = errors.New("gamemodes_server.txt was not written by the panel; pass overwrite=true to replace it")
+)
+
+// AvailableMap is a map the server can load.
+type AvailableMap struct {
+	Name       string `json:"name,omitempty"`
+	WorkshopID string `json:"workshopId,omitempty"`
+	// Source is disk for maps in MAPS_DIR and workshop for workshop items.
+	Source string `json:"source"`
+	// Downloaded is false for attached workshop maps the game hasn't
+	// fetched yet.
+	Downloaded bool `json:"downloaded"`
+}
+
+type MapsResponse struct {
+	Maps    []AvailableMap `json:"maps"`
+	Warning string         `json:"warning,omitempty"`
+}
+
+type ChangeMapRequest struct {
+	Map string `json:"map"`
+}
+
+// RotationResponse is a server's rotation with the pool it uses.
+type RotationResponse struct {
+	rotation.Rotation
+	MapGroup string     `json:"mapGroup"`
+	Maps     []string   `json:"maps"`
+	NextAt   *time.Time `json:"nextAt,omitempty"`
+	// Pending lists the settings that wait for a restart, usually the
+	// mapGroup.
+	Pending []string `json:"pending,omitempty"`
+	Warning string   `json:"warning,omitempty"`
+}
+
+// MapPoolResponse is a saved pool with the servers rotating through it,
+// whose gamemodes_server.txt was rendered again.
+type MapPoolResponse struct {
+	rotation.Pool
+	Servers []MapPoolServer `json:"servers"`
+}
+
+// MapPoolServer is the outcome for one server using a changed pool. Status
+// is "updated", or "pending" with the error when the server keeps the old
+// maps until its gamemodes_server.txt is written.
+type MapPoolServer struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type MissingMapsResponse struct {
+	Error   string   `json:"error"`
+	Missing []string `json:"missing"`
+}
+
+func (s *Server) handleListMapPools(w http.ResponseWriter, r *http.Request) {
+	pools, err := s.rotations.Pools()
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, pools)
+}
+
+func (s *Server) handleGetMapPool(w http.ResponseWriter, r *http.Request) {
+	pool, err := s.rotations.Pool(r.PathValue("name"))
+	if err != nil {
+		s.mapPoolError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, pool)
+}
+
+// handlePutMapPool creates or replaces a map pool. Only the format of the
+// entries is checked here, as a pool can be shared by servers with
+// different maps installed; they are checked against a server when it is
+// given a rotation through the pool. Servers already rotating through the
+// pool get their gamemodes_server.txt rendered again.
+func (s *Server) handlePutMapPool(w http.ResponseWriter, r *http.Request) {
+	var pool rotation.Pool
+	if err := json.NewDecoder(r.Body).Decode(&pool); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	pool.Name = r.PathValue("name")
+	if err := pool.Validate(); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.rotations.PutPool(pool); err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), settingsTimeout)
+	defer cancel()
+
+	servers, err := s.renderPoolServers(ctx, pool.Name)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": "pool saved, but listing the servers using it failed: " + err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, MapPoolResponse{Pool: pool, Servers: servers})
+}
+
+// renderPoolServers writes gamemodes_server.txt again on every server whose
+// rotation uses the pool. A file the panel didn't write is left alone.
+func (s *Server) renderPoolServers(ctx context.Context, name string) ([]MapPoolServer, error) {
+	containers, err := s.docker.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+	servers := []MapPoolServer{}
+	for _, c := range containers {
+		if c.Labels["cloudstrike"] != "true" {
+			continue
+		}
+		rot, ok, err := s.rotations.Rotation(s.serverKey(c.ID))
+		if err != nil || !ok || rot.Pool != name {
+			continue
+		}
+		server := MapPoolServer{ID: docker.ServerID(c.ID, c.Labels), Name: c.Labels["cloudstrike.name"], Status: "updated"}
+		if err := s.writeGameModes(ctx, c.ID, false); err != nil {
+			server.Status = "pending"
+			server.Error = err.Error()
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+func (s *Server) handleDeleteMapPool(w http.ResponseWriter, r *http.Request) {
+	if err := s.rotations.DeletePool(r.PathValue("name")); err != nil {
+		s.mapPoolError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleListMaps lists the maps in MAPS_DIR and the workshop maps the
+// server has downloaded or attached.
+func (s *Server) handleListMaps(w http.ResponseWriter, r *http.Request) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	available, warning, err := s.availableMaps(ctx, fullID)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, MapsResponse{Maps: available, Warning: warning})
+}
+
+// handleChangeMap changes the map of a running server right away. The map
+// must be in MAPS_DIR or be a downloaded or attached workshop item.
+func (s *Server) handleChangeMap(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req ChangeMapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	m, err := rotation.ParseMap(req.Map)
+	if err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+	state, err := s.docker.State(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if !state.Running {
+		s.json(w, http.StatusConflict, map[string]string{"error": errNotRunning.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	available, _, err := s.availableMaps(ctx, fullID)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	if !mapAvailable(available, m) {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("map %s is neither in %s nor in the workshop", req.Map, s.cfg.MapsDir)})
+		return
+	}
+
+	if err := s.ensureRCON(id, fullID); err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if _, err := s.rcon.Execute(id, m.Command()); err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, map[string]string{"map": req.Map, "command": m.Command()})
+}
+
+func (s *Server) handleGetRotation(w http.ResponseWriter, r *http.Request) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	rot, ok, err := s.rotations.Rotation(s.serverKey(fullID))
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if !ok {
+		s.json(w, http.StatusNotFound, map[string]string{"error": errNoRotation.Error()})
+		return
+	}
+	pool, err := s.rotations.Pool(rot.Pool)
+	if err != nil {
+		s.mapPoolError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, rotationResponse(rot, pool))
+}
+
+// handlePutRotation makes the server rotate through a map pool. Every map of
+// the pool must be available on the server. The mapgroups of all pools are
+// written to gamemodes_server.txt and the server's mapGroup setting is
+// pointed at the pool, which takes effect on the next restart.
+func (s *Server) handlePutRotation(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var rot rotation.Rotation
+	if err := json.NewDecoder(r.Body).Decode(&rot); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if rot.Mode == "" {
+		rot.Mode = rotation.Order
+	}
+	if err := rot.Validate(); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	rot.LastMap = ""
+	rot.LastRotated = time.Now()
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+	pool, err := s.rotations.Pool(rot.Pool)
+	if err != nil {
+		if errors.Is(err, rotation.ErrNotFound) {
+			s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	available, warning, err := s.availableMaps(ctx, fullID)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+	missing := []string{}
+	for _, entry := range pool.Maps {
+		if m, _ := rotation.ParseMap(entry); !mapAvailable(available, m) {
+			missing = append(missing, entry)
+		}
+	}
+	if len(missing) > 0 {
+		s.json(w, http.StatusBadRequest, MissingMapsResponse{Error: "maps of the pool are not available on the server", Missing: missing})
+		return
+	}
+
+	if err := s.writeGameModes(ctx, fullID, r.URL.Query().Get("overwrite") == "true"); err != nil {
+		if errors.Is(err, errUnmanagedGameModes) {
+			s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		s.fileError(w, err)
+		return
+	}
+
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	settings.MapGroup = pool.MapGroup()
+	applied, err := s.applySettings(id, fullID, s.requestAuthor(r), settings)
+	if err != nil {
+		s.settingsError(w, err)
+		return
+	}
+
+	if err := s.rotations.PutRotation(s.serverKey(fullID), rot); err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := rotationResponse(rot, pool)
+	resp.Pending = applied.Pending
+	resp.Warning = warning
+	if applied.Warning != "" {
+		resp.Warning = applied.Warning
+	}
+	s.json(w, http.StatusOK, resp)
+}
+
+// handleDeleteRotation stops rotating the server's maps. The mapgroup and
+// gamemodes_server.txt are left as they are.
+func (s *Server) handleDeleteRotation(w http.ResponseWriter, r *http.Request) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+	if err := s.rotations.RemoveRotation(s.serverKey(fullID)); err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleRotateMap changes to the next map of the rotation right away.
+func (s *Server) handleRotateMap(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	next, err := s.rotateMap(id, fullID, false)
+	switch {
+	case errors.Is(err, errNoRotation):
+		s.json(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errNotRunning):
+		s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	default:
+		s.json(w, http.StatusOK, map[string]string{"map": next})
+	}
+}
+
+// rotateMap changes the server to the next map of its rotation and returns
+// it. A scheduled rotation of a server with OnlyWhenEmpty set is skipped
+// while players are connected, returning "".
+func (s *Server) rotateMap(id, fullID string, scheduled bool) (string, error) {
+	key := s.serverKey(fullID)
+	rot, ok, err := s.rotations.Rotation(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errNoRotation
+	}
+	pool, err := s.rotations.Pool(rot.Pool)
+	if err != nil {
+		return "", err
+	}
+	state, err := s.docker.State(fullID)
+	if err != nil {
+		return "", err
+	}
+	if !state.Running {
+		return "", errNotRunning
+	}
+
+	if err := s.ensureRCON(id, fullID); err != nil {
+		return "", err
+	}
+	output, err := s.rcon.Execute(id, "status")
+	if err != nil {
+		return "", err
+	}
+	status, ok := rcon.ParseStatus(output)
+	if scheduled && rot.OnlyWhenEmpty && (!ok || status.Players > 0) {
+		return "", nil
+	}
+	current := status.Map
+	if current == "" {
+		current = rot.LastMap
+	}
+
+	next := rotation.Next(pool, rot.Mode, current)
+	m, err := rotation.ParseMap(next)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.rcon.Execute(id, m.Command()); err != nil {
+		return "", err
+	}
+
+	rot.LastMap = next
+	rot.LastRotated = time.Now()
+	return next, s.rotations.PutRotation(key, rot)
+}
+
+// runRotations changes the map of every running server whose scheduled
+// rotation is due, checking every ROTATION_CHECK_INTERVAL.
+func (s *Server) runRotations() {
+	ticker := time.NewTicker(s.cfg.RotationCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		containers, err := s.docker.ListContainers()
+		if err != nil {
+			log.Printf("Map rotation: listing servers failed: %v", err)
+			continue
+		}
+		for _, c := range containers {
+			if c.Labels["cloudstrike"] != "true" || c.State != "running" {
+				continue
+			}
+			rot, ok, err := s.rotations.Rotation(s.serverKey(c.ID))
+			if err != nil || !ok || !rot.Due(time.Now()) {
+				continue
+			}
+			id := docker.ServerID(c.ID, c.Labels)
+			next, err := s.rotateMap(id, c.ID, true)
+			if err != nil {
+				log.Printf("Map rotation on %s failed: %v", id, err)
+				continue
+			}
+			if next != "" {
+				log.Printf("Map rotation: %s changed to %s", id, next)
+			}
+		}
+	}
+}
+
+// availableMaps lists the maps in MAPS_DIR and the downloaded and attached
+// workshop maps. If the workshop collection can't be expanded the maps are
+// still listed, along with a warning.
+func (s *Server) availableMaps(ctx context.Context, fullID string) ([]AvailableMap, string, error) {
+	dir, err := s.files.Resolve(fullID, s.cfg.MapsDir, files.Read)
+	if err != nil {
+		return nil, "", err
+	}
+	usage, err := s.files.DirUsage(ctx, fullID, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	available := []AvailableMap{}
+	for _, u := range usage {
+		if name, ok := strings.CutSuffix(u.Name, ".vpk"); ok && u.Files > 0 {
+			available = append(available, AvailableMap{Name: name, Source: "disk", Downloaded: true})
+		}
+	}
+
+	downloads, err := s.workshopDownloads(ctx, fullID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, d := range downloads {
+		m := AvailableMap{WorkshopID: d.ID, Source: "workshop", Downloaded: true}
+		for _, f := range d.Maps {
+			if name, ok := strings.CutSuffix(filepath.Base(f), ".vpk"); ok {
+				m.Name = name
+				break
+			}
+		}
+		available = append(available, m)
+	}
+
+	var warning string
+	attached, err := s.attachedWorkshopItems(ctx, fullID)
+	if err != nil {
+		warning = err.Error()
+	}
+	for _, itemID := range slices.Sorted(maps.Keys(attached)) {
+		if !slices.ContainsFunc(available, func(m AvailableMap) bool { return m.WorkshopID == itemID }) {
+			available = append(available, AvailableMap{WorkshopID: itemID, Source: "workshop"})
+		}
+	}
+	return available, warning, nil
+}
+
+// mapAvailable reports whether m is in the list from availableMaps.
+func mapAvailable(available []AvailableMap, m rotation.Map) bool {
+	return slices.ContainsFunc(available, func(a AvailableMap) bool {
+		if m.WorkshopID != "" {
+			return a.WorkshopID == m.WorkshopID
+		}
+		return a.Source == "disk" && a.Name == m.Name
+	})
+}
+
+// writeGameModes renders the mapgroups of every pool into
+// gamemodes_server.txt. A file the panel didn't write is only replaced with
+// overwrite set.
+func (s *Server) writeGameModes(ctx context.Context, fullID string, overwrite bool) error {
+	pools, err := s.rotations.Pools()
+	if err != nil {
+		return err
+	}
+
+	p, err := s.files.Resolve(fullID, gameModesServer, files.Write)
+	if err != nil {
+		return err
+	}
+	defer s.files.Lock(fullID, p)()
+
+	current, err := s.files.ReadFile(fullID, p, s.cfg.FilesEditMax)
+	switch {
+	case err == nil:
+		if !overwrite && !rotation.IsManaged(current.Data) {
+			return errUnmanagedGameModes
+		}
+	case errors.Is(err, docker.ErrPathNotFound):
+	case errors.Is(err, files.ErrTooLarge) && overwrite:
+	default:
+		return err
+	}
+
+	uid, gid, err := s.files.Owner(ctx, fullID, filepath.Dir(p))
+	if err != nil {
+		return err
+	}
+	return s.files.WriteFile(ctx, fullID, p, rotation.Render(pools), 0o644, uid, gid)
+}
+
+func rotationResponse(rot rotation.Rotation, pool rotation.Pool) RotationResponse {
+	resp := RotationResponse{Rotation: rot, MapGroup: pool.MapGroup(), Maps: pool.Maps}
+	if next := rot.NextAt(); !next.IsZero() {
+		resp.NextAt = &next
+	}
+	return resp
+}
+
+// mapPoolError writes the response for a failed map pool store call.
+func (s *Server) mapPoolError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rotation.ErrNotFound):
+		s.json(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, rotation.ErrInUse):
+		s.json(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -2,38 +2,77 @@ package api
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 
+	"github.com/chi2l3s/cloudstrike/internal/audit"
+	"github.com/chi2l3s/cloudstrike/internal/auth"
 	"github.com/chi2l3s/cloudstrike/internal/config"
 	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/jobs"
+	"github.com/chi2l3s/cloudstrike/internal/presets"
 	"github.com/chi2l3s/cloudstrike/internal/rcon"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+	"github.com/chi2l3s/cloudstrike/internal/rotation"
+	"github.com/chi2l3s/cloudstrike/internal/uploads"
+	"github.com/chi2l3s/cloudstrike/internal/workshop"
 )
 
 type Server struct {
-	cfg    *config.Config
-	docker *docker.Client
-	rcon   *rcon.Manager
-	router *http.ServeMux
+	cfg       *config.Config
+	docker    *docker.Client
+	auth      *auth.Store
+	rcon      *rcon.Manager
+	jobs      *jobs.Manager
+	files     *files.Sandbox
+	uploads   *uploads.Store
+	revisions *revisions.Store
+	workshop  *workshop.Store
+	steam     workshop.MetadataSource
+	presets   *presets.Store
+	rotations *rotation.Store
+	audit     *audit.Logger
+	router    *http.ServeMux
 }
 
-func NewServer(cfg *config.Config, dockerClient *docker.Client) *Server {
+func NewServer(cfg *config.Config, dockerClient *docker.Client, authStore *auth.Store, uploadStore *uploads.Store, revisionStore *revisions.Store, workshopStore *workshop.Store, workshopSource workshop.MetadataSource, presetStore *presets.Store, rotationStore *rotation.Store, auditLog *audit.Logger) *Server {
 	s := &Server{
 		cfg:    cfg,
 		docker: dockerClient,
+		auth:   authStore,
 		rcon:   rcon.NewManager(),
-		router: http.NewServeMux(),
+		jobs:   jobs.NewManager(),
+		files: files.NewSandbox(dockerClient, map[string]files.Policy{
+			files.DefaultTemplate: {Root: cfg.FilesRoot, ReadOnly: cfg.FilesReadOnly},
+		}),
+		uploads:   uploadStore,
+		revisions: revisionStore,
+		workshop:  workshopStore,
+		steam:     workshopSource,
+		presets:   presetStore,
+		rotations: rotationStore,
+		audit:     auditLog,
+		router:    http.NewServeMux(),
 	}
 	s.setupRoutes()
+	s.registerMetrics()
 	return s
 }
 
 func (s *Server) setupRoutes() {
 	s.router.HandleFunc("GET /api/health", s.handleHealth)
+	if s.cfg.MetricsToken != "" {
+		s.router.Handle("GET /metrics", s.metricsHandler())
+	}
 	s.router.HandleFunc("GET /api/servers", s.handleListServers)
 	s.router.HandleFunc("POST /api/servers", s.handleCreateServer)
 	s.router.HandleFunc("POST /api/servers/{id}/start", s.handleStartServer)
 	s.router.HandleFunc("POST /api/servers/{id}/stop", s.handleStopServer)
+	s.router.HandleFunc("POST /api/servers/{id}/restart", s.handleRestartServer)
 	s.router.HandleFunc("DELETE /api/servers/{id}", s.handleDeleteServer)
+	s.router.HandleFunc("POST /api/servers/{id}/clone", s.handleCloneServer)
+	s.router.HandleFunc("POST /api/servers/bulk", s.handleBulk)
 
 	s.router.HandleFunc("POST /api/servers/{id}/rcon/connect", s.handleRCONConnect)
 	s.router.HandleFunc("POST /api/servers/{id}/rcon/command", s.handleRCONCommand)
@@ -47,25 +86,100 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("GET /api/servers/{id}/files", s.handleListFiles)
 	s.router.HandleFunc("DELETE /api/servers/{id}/files", s.handleDeleteFile)
 	s.router.HandleFunc("POST /api/servers/{id}/files/upload", s.handleUploadFile)
+	s.router.HandleFunc("POST /api/servers/{id}/files/uploads", s.handleCreateUpload)
+	s.router.HandleFunc("GET /api/servers/{id}/files/uploads/{uploadId}", s.handleGetUpload)
+	s.router.HandleFunc("PATCH /api/servers/{id}/files/uploads/{uploadId}", s.handleUploadChunk)
+	s.router.HandleFunc("POST /api/servers/{id}/files/uploads/{uploadId}/complete", s.handleCompleteUpload)
+	s.router.HandleFunc("DELETE /api/servers/{id}/files/uploads/{uploadId}", s.handleCancelUpload)
 	s.router.HandleFunc("GET /api/servers/{id}/files/download", s.handleDownloadFile)
+	s.router.HandleFunc("GET /api/servers/{id}/files/search", s.handleSearchFiles)
+	s.router.HandleFunc("GET /api/servers/{id}/files/content", s.handleGetFileContent)
+	s.router.HandleFunc("PUT /api/servers/{id}/files/content", s.handlePutFileContent)
+	s.router.HandleFunc("GET /api/servers/{id}/files/keyvalues", s.handleGetKeyValues)
+	s.router.HandleFunc("PUT /api/servers/{id}/files/keyvalues", s.handlePutKeyValues)
+	s.router.HandleFunc("PATCH /api/servers/{id}/files/keyvalues", s.handlePatchKeyValues)
+	s.router.HandleFunc("POST /api/servers/{id}/files/mkdir", s.handleMkdir)
+	s.router.HandleFunc("POST /api/servers/{id}/files/rename", s.handleRenameFiles)
+	s.router.HandleFunc("POST /api/servers/{id}/files/move", s.handleMoveFiles)
+	s.router.HandleFunc("POST /api/servers/{id}/files/copy", s.handleCopyFiles)
+	s.router.HandleFunc("POST /api/servers/{id}/files/chmod", s.handleChmodFiles)
+	s.router.HandleFunc("POST /api/servers/{id}/files/extract", s.handleExtract)
+	s.router.HandleFunc("POST /api/servers/{id}/files/compress", s.handleCompress)
+	s.router.HandleFunc("GET /api/servers/{id}/files/revisions", s.handleListRevisions)
+	s.router.HandleFunc("GET /api/servers/{id}/files/revisions/diff", s.handleDiffRevisions)
+	s.router.HandleFunc("GET /api/servers/{id}/files/revisions/{rev}", s.handleGetRevision)
+	s.router.HandleFunc("POST /api/servers/{id}/files/revisions/{rev}/revert", s.handleRevertRevision)
 
 	// Settings
 	s.router.HandleFunc("GET /api/servers/{id}/settings", s.handleGetSettings)
 	s.router.HandleFunc("PUT /api/servers/{id}/settings", s.handleUpdateSettings)
+	s.router.HandleFunc("GET /api/servers/{id}/settings/export", s.handleExportSettings)
+	s.router.HandleFunc("POST /api/servers/{id}/settings/import", s.handleImportSettings)
+	s.router.HandleFunc("GET /api/cvars", s.handleGetCvarSchema)
+
+	// Presets
+	s.router.HandleFunc("GET /api/presets", s.handleListPresets)
+	s.router.HandleFunc("GET /api/presets/{name}", s.handleGetPreset)
+	s.router.HandleFunc("PUT /api/presets/{name}", s.handleSavePreset)
+	s.router.HandleFunc("DELETE /api/presets/{name}", s.handleDeletePreset)
+	s.router.HandleFunc("GET /api/servers/{id}/presets/{name}/preview", s.handlePreviewPreset)
+	s.router.HandleFunc("POST /api/servers/{id}/presets/{name}/apply", s.handleApplyPreset)
+
+	// Maps
+	s.router.HandleFunc("GET /api/mappools", s.handleListMapPools)
+	s.router.HandleFunc("GET /api/mappools/{name}", s.handleGetMapPool)
+	s.router.HandleFunc("PUT /api/mappools/{name}", s.handlePutMapPool)
+	s.router.HandleFunc("DELETE /api/mappools/{name}", s.handleDeleteMapPool)
+	s.router.HandleFunc("GET /api/servers/{id}/maps", s.handleListMaps)
+	s.router.HandleFunc("POST /api/servers/{id}/map", s.handleChangeMap)
+	s.router.HandleFunc("GET /api/servers/{id}/rotation", s.handleGetRotation)
+	s.router.HandleFunc("PUT /api/servers/{id}/rotation", s.handlePutRotation)
+	s.router.HandleFunc("DELETE /api/servers/{id}/rotation", s.handleDeleteRotation)
+	s.router.HandleFunc("POST /api/servers/{id}/rotation/next", s.handleRotateMap)
+
+	// Workshop
+	s.router.HandleFunc("GET /api/servers/{id}/workshop", s.handleGetWorkshop)
+	s.router.HandleFunc("PUT /api/servers/{id}/workshop", s.handleUpdateWorkshop)
+	s.router.HandleFunc("GET /api/servers/{id}/workshop/downloads", s.handleListWorkshopDownloads)
+	s.router.HandleFunc("DELETE /api/servers/{id}/workshop/downloads/{itemId}", s.handleDeleteWorkshopDownload)
+	s.router.HandleFunc("POST /api/servers/{id}/workshop/prune", s.handlePruneWorkshop)
+
+	// Jobs
+	s.router.HandleFunc("GET /api/servers/{id}/jobs", s.requirePermission(auth.PermJobs, s.handleListJobs))
+	s.router.HandleFunc("GET /api/servers/{id}/jobs/{jobId}", s.requirePermission(auth.PermJobs, s.handleGetJob))
+	s.router.HandleFunc("DELETE /api/servers/{id}/jobs/{jobId}", s.requirePermission(auth.PermJobs, s.handleCancelJob))
 
 	// Logs
 	s.router.HandleFunc("GET /api/servers/{id}/logs", s.handleGetLogs)
+
+	// Terminal
+	s.router.HandleFunc("GET /api/servers/{id}/terminal", s.requirePermission(auth.PermTerminal, s.handleTerminal))
+	s.router.HandleFunc("GET /api/servers/{id}/console", s.requirePermission(auth.PermConsole, s.handleConsole))
+	s.router.HandleFunc("POST /api/servers/{id}/exec", s.requirePermission(auth.PermExec, s.handleExec))
 }
 
+// Run serves the HTTP API and, when SFTP_ADDR is set, the SFTP server. It
+// returns when the HTTP API fails; an SFTP failure is only logged, so the
+// panel stays up without it. Scheduled map rotations run in the background.
 func (s *Server) Run() error {
-	return http.ListenAndServe(":"+s.cfg.Port, s.corsMiddleware(s.router))
+	go s.runRotations()
+
+	if s.cfg.SFTPAddr != "" {
+		go func() {
+			if err := s.runSFTP(); err != nil {
+				log.Printf("SFTP server on %s stopped: %v", s.cfg.SFTPAddr, err)
+			}
+		}()
+	}
+	return http.ListenAndServe(":"+s.cfg.Port, s.corsMiddleware(s.metricsMiddleware(s.router)))
 }
 
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, Upload-Offset, X-Chunk-SHA256")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, ETag, Upload-Offset")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
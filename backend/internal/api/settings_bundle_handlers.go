@@ -0,0 +1,831 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/chi2l3s/cloudstrike/internal/auth"
+	"github.com/chi2l3s/cloudstrike/internal/cvars"
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/presets"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+	"github.com/chi2l3s/cloudstrike/internal/rotation"
+	"github.com/chi2l3s/cloudstrike/internal/workshop"
+)
+
+// settingsBundleVersion is the format of the bundles written by export.
+const settingsBundleVersion = 1
+
+// maxBundleSize bounds an imported bundle.
+const maxBundleSize = 32 << 20
+
+// SettingsBundle is the portable configuration of a server: its settings,
+// workshop content and map rotation, with the custom presets, map pools and
+// config files they build on. Importing applies the parts a bundle has and
+// leaves everything else on the target server alone.
+type SettingsBundle struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// Source names the server the bundle was exported from.
+	Source string `json:"source,omitempty"`
+	// SecretsExcluded is set when the passwords were left out; importing
+	// keeps those of the target server.
+	SecretsExcluded bool             `json:"secretsExcluded,omitempty"`
+	Settings        *ServerSettings  `json:"settings,omitempty"`
+	Workshop        *workshop.Config `json:"workshop,omitempty"`
+	Rotation        *BundleRotation  `json:"rotation,omitempty"`
+	Presets         []presets.Preset `json:"presets,omitempty"`
+	MapPools        []rotation.Pool  `json:"mapPools,omitempty"`
+	Files           []BundleFile     `json:"files,omitempty"`
+}
+
+// BundleRotation is a map rotation without the state of the server it ran
+// on.
+type BundleRotation struct {
+	Pool            string        `json:"pool"`
+	Mode            rotation.Mode `json:"mode"`
+	IntervalMinutes int           `json:"intervalMinutes"`
+	OnlyWhenEmpty   bool          `json:"onlyWhenEmpty"`
+}
+
+// BundleFile is a text file of the server. Path is relative to FILES_ROOT,
+// so the file lands in the same place on any server of the same layout.
+type BundleFile struct {
+	Path     string `json:"path"`
+	Encoding string `json:"encoding,omitempty"`
+	Content  string `json:"content"`
+}
+
+// BundleChange is what importing a bundle does to one of its items.
+type BundleChange struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// Diff is a unified diff of a created or changed file.
+	Diff string `json:"diff,omitempty"`
+}
+
+const (
+	bundleCreate    = "create"
+	bundleUpdate    = "update"
+	bundleUnchanged = "unchanged"
+)
+
+type SettingsImportResponse struct {
+	DryRun   bool            `json:"dryRun"`
+	Settings []SettingChange `json:"settings"`
+	Workshop *BundleChange   `json:"workshop,omitempty"`
+	Rotation *BundleChange   `json:"rotation,omitempty"`
+	Presets  []BundleChange  `json:"presets"`
+	MapPools []BundleChange  `json:"mapPools"`
+	Files    []BundleChange  `json:"files"`
+	// Applied reports how the settings reached the game. Dry runs leave it
+	// out.
+	Applied *SettingsResponse `json:"applied,omitempty"`
+	Warning string            `json:"warning,omitempty"`
+}
+
+// bundleError is a part of a bundle that can't be imported.
+type bundleError struct {
+	part string
+	err  error
+}
+
+func (e *bundleError) Error() string {
+	return e.part + ": " + e.err.Error()
+}
+
+func (e *bundleError) Unwrap() error {
+	return e.err
+}
+
+// bundleImport is a checked bundle: the items that differ from what the
+// server and the panel have.
+type bundleImport struct {
+	settings *ServerSettings
+	workshop *workshop.Config
+	rotation *rotation.Rotation
+	// gameModes is set when gamemodes_server.txt needs to be written again.
+	gameModes bool
+	presets   []presets.Preset
+	pools     []rotation.Pool
+	files     []bundleWrite
+}
+
+type bundleWrite struct {
+	// path is resolved.
+	path string
+	data []byte
+}
+
+// handleExportSettings writes the configuration of the server as a bundle,
+// in JSON or, with ?format=yaml, in YAML. Config files are picked with
+// repeated ?file= parameters. The passwords are left out unless the request
+// asks for them with ?secrets=true and its user has the secrets permission.
+func (s *Server) handleExportSettings(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "yaml" {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "format must be json or yaml"})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	secrets := q.Get("secrets") == "true"
+	if secrets && !s.checkPermission(w, r, auth.PermSecrets, fullID) {
+		return
+	}
+
+	bundle, err := s.exportBundle(fullID, q["file"], secrets)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	contentType := "application/json"
+	var data []byte
+	if format == "yaml" {
+		contentType = "application/yaml"
+		data, err = bundleYAML(bundle)
+	} else {
+		data, err = json.MarshalIndent(bundle, "", "  ")
+	}
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", attachment(bundle.Source+"-settings."+format))
+	w.Write(data)
+}
+
+// handleImportSettings applies a bundle in JSON or YAML to the server. The
+// whole bundle is checked before anything changes; ?dryRun=true stops there
+// and reports what would change. ?secrets=false keeps the passwords of the
+// server, as does a bundle exported without them. The server name is kept
+// too, unless ?identity=true asks to take it from the bundle. Like a
+// settings update, what can't change live waits for the next restart, or
+// triggers one right away with ?restart=true.
+func (s *Server) handleImportSettings(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	q := r.URL.Query()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.json(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "bundle is too large"})
+			return
+		}
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	bundle, err := decodeBundle(body)
+	if err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), settingsTimeout)
+	defer cancel()
+
+	plan, resp, err := s.planImport(ctx, fullID, bundle, importOptions{
+		secrets:  q.Get("secrets") != "false",
+		identity: q.Get("identity") == "true",
+	})
+	if err != nil {
+		s.importError(w, err)
+		return
+	}
+	if q.Get("dryRun") == "true" {
+		resp.DryRun = true
+		s.json(w, http.StatusOK, resp)
+		return
+	}
+
+	applied, warning, err := s.applyImport(ctx, id, fullID, plan, s.requestAuthor(r))
+	if err != nil {
+		s.importError(w, err)
+		return
+	}
+	resp.Applied = applied
+	if warning != "" {
+		resp.Warning = warning
+	}
+
+	if q.Get("restart") == "true" {
+		if err := s.restartForPending(id, fullID, applied); err != nil {
+			s.json(w, http.StatusInternalServerError, map[string]string{"error": "bundle imported, but the restart failed: " + err.Error()})
+			return
+		}
+	}
+
+	s.json(w, http.StatusOK, resp)
+}
+
+// exportBundle collects the configuration of a server and the files at
+// paths into a bundle. Only custom presets are included, as every panel has
+// the built-in ones.
+func (s *Server) exportBundle(fullID string, paths []string, secrets bool) (*SettingsBundle, error) {
+	key := s.serverKey(fullID)
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &SettingsBundle{
+		Version:    settingsBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Source:     key,
+		Settings:   settings,
+		Presets:    []presets.Preset{},
+		Files:      []BundleFile{},
+	}
+	if !secrets {
+		settings.RconPassword, settings.SvPassword = "", ""
+		bundle.SecretsExcluded = true
+	}
+
+	ws, err := s.workshop.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ws.Maps) > 0 || ws.Collection != "" {
+		bundle.Workshop = &ws
+	}
+
+	rot, ok, err := s.rotations.Rotation(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		bundle.Rotation = &BundleRotation{
+			Pool:            rot.Pool,
+			Mode:            rot.Mode,
+			IntervalMinutes: rot.IntervalMinutes,
+			OnlyWhenEmpty:   rot.OnlyWhenEmpty,
+		}
+	}
+
+	list, err := s.presets.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if !p.BuiltIn {
+			bundle.Presets = append(bundle.Presets, p)
+		}
+	}
+	if bundle.MapPools, err = s.rotations.Pools(); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.files.Policy(fullID)
+	if err != nil {
+		return nil, err
+	}
+	root := path.Clean(policy.Root)
+	for _, p := range paths {
+		resolved, err := s.files.Resolve(fullID, p, files.Read)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		rel := strings.TrimPrefix(resolved, root+"/")
+		if slices.ContainsFunc(bundle.Files, func(f BundleFile) bool { return f.Path == rel }) {
+			continue
+		}
+		file, err := s.files.ReadFile(fullID, resolved, s.cfg.FilesEditMax)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		content, encoding, err := files.DecodeText(file.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		bundle.Files = append(bundle.Files, BundleFile{Path: rel, Encoding: encoding, Content: content})
+	}
+	return bundle, nil
+}
+
+// importOptions picks the settings a bundle may overwrite besides the
+// configuration itself.
+type importOptions struct {
+	// secrets takes the passwords from the bundle, if it has them.
+	secrets bool
+	// identity takes the server name from the bundle.
+	identity bool
+}
+
+// planImport checks every part of a bundle against the server and the
+// panel and reports what importing it would change.
+func (s *Server) planImport(ctx context.Context, fullID string, bundle *SettingsBundle, opts importOptions) (*bundleImport, *SettingsImportResponse, error) {
+	key := s.serverKey(fullID)
+	plan := &bundleImport{}
+	resp := &SettingsImportResponse{
+		Settings: []SettingChange{},
+		Presets:  []BundleChange{},
+		MapPools: []BundleChange{},
+		Files:    []BundleChange{},
+	}
+
+	pools := map[string]rotation.Pool{}
+	for _, pool := range bundle.MapPools {
+		part := "map pool " + pool.Name
+		if _, dup := pools[pool.Name]; dup {
+			return nil, nil, &bundleError{part, errors.New("listed twice")}
+		}
+		if err := pool.Validate(); err != nil {
+			return nil, nil, &bundleError{part, err}
+		}
+		if pool.Maps == nil {
+			pool.Maps = []string{}
+		}
+		pools[pool.Name] = pool
+
+		action := bundleUpdate
+		current, err := s.rotations.Pool(pool.Name)
+		switch {
+		case errors.Is(err, rotation.ErrNotFound):
+			action = bundleCreate
+		case err != nil:
+			return nil, nil, err
+		case current.Description == pool.Description && slices.Equal(current.Maps, pool.Maps):
+			action = bundleUnchanged
+		}
+		resp.MapPools = append(resp.MapPools, BundleChange{Name: pool.Name, Action: action})
+		if action != bundleUnchanged {
+			plan.pools = append(plan.pools, pool)
+		}
+	}
+
+	for _, p := range bundle.Presets {
+		part := "preset " + p.Name
+		switch {
+		case presets.IsBuiltIn(p.Name):
+			return nil, nil, &bundleError{part, presets.ErrBuiltIn}
+		case !presets.ValidName(p.Name):
+			return nil, nil, &bundleError{part, presets.ErrName}
+		case slices.ContainsFunc(plan.presets, func(q presets.Preset) bool { return q.Name == p.Name }),
+			slices.ContainsFunc(resp.Presets, func(c BundleChange) bool { return c.Name == p.Name }):
+			return nil, nil, &bundleError{part, errors.New("listed twice")}
+		}
+		p.BuiltIn = false
+		if err := validatePreset(&p); err != nil {
+			return nil, nil, &bundleError{part, err}
+		}
+
+		action := bundleUpdate
+		current, err := s.presets.Get(p.Name)
+		switch {
+		case errors.Is(err, presets.ErrNotFound):
+			action = bundleCreate
+		case err != nil:
+			return nil, nil, err
+		case samePreset(current, &p):
+			action = bundleUnchanged
+		}
+		resp.Presets = append(resp.Presets, BundleChange{Name: p.Name, Action: action})
+		if action != bundleUnchanged {
+			plan.presets = append(plan.presets, p)
+		}
+	}
+
+	for _, f := range bundle.Files {
+		change, write, err := s.planFile(fullID, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		if slices.ContainsFunc(plan.files, func(w bundleWrite) bool { return w.path == write.path }) ||
+			slices.ContainsFunc(resp.Files, func(c BundleChange) bool { return c.Name == f.Path }) {
+			return nil, nil, &bundleError{"file " + f.Path, errors.New("listed twice")}
+		}
+		resp.Files = append(resp.Files, change)
+		if change.Action != bundleUnchanged {
+			plan.files = append(plan.files, write)
+		}
+	}
+
+	if bundle.Workshop != nil {
+		cfg := *bundle.Workshop
+		if err := cfg.Validate(); err != nil {
+			return nil, nil, &bundleError{"workshop", err}
+		}
+		if cfg.Maps == nil {
+			cfg.Maps = []string{}
+		}
+		current, err := s.workshop.Get(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		action := bundleUpdate
+		switch {
+		case slices.Equal(current.Maps, cfg.Maps) && current.Collection == cfg.Collection && current.StartMap == cfg.StartMap:
+			action = bundleUnchanged
+		case len(current.Maps) == 0 && current.Collection == "":
+			action = bundleCreate
+		}
+		resp.Workshop = &BundleChange{Name: "workshop", Action: action}
+		if action != bundleUnchanged {
+			plan.workshop = &cfg
+		}
+	}
+
+	if bundle.Rotation != nil {
+		rot := rotation.Rotation{
+			Pool:            bundle.Rotation.Pool,
+			Mode:            bundle.Rotation.Mode,
+			IntervalMinutes: bundle.Rotation.IntervalMinutes,
+			OnlyWhenEmpty:   bundle.Rotation.OnlyWhenEmpty,
+		}
+		if rot.Mode == "" {
+			rot.Mode = rotation.Order
+		}
+		if err := rot.Validate(); err != nil {
+			return nil, nil, &bundleError{"rotation", err}
+		}
+		pool, ok := pools[rot.Pool]
+		if !ok {
+			var err error
+			pool, err = s.rotations.Pool(rot.Pool)
+			if errors.Is(err, rotation.ErrNotFound) {
+				return nil, nil, &bundleError{"rotation", err}
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		action := bundleUpdate
+		current, exists, err := s.rotations.Rotation(key)
+		switch {
+		case err != nil:
+			return nil, nil, err
+		case !exists:
+			action = bundleCreate
+		case current.Pool == rot.Pool && current.Mode == rot.Mode &&
+			current.IntervalMinutes == rot.IntervalMinutes && current.OnlyWhenEmpty == rot.OnlyWhenEmpty:
+			action = bundleUnchanged
+		}
+		resp.Rotation = &BundleChange{Name: rot.Pool, Action: action}
+		if action != bundleUnchanged {
+			plan.rotation = &rot
+		}
+		plan.gameModes = plan.rotation != nil || len(plan.pools) > 0
+
+		// The maps may still arrive with the workshop content of the bundle,
+		// so missing ones don't stop the import.
+		available, _, err := s.availableMaps(ctx, fullID)
+		if err != nil {
+			resp.Warning = "could not check the maps of the pool: " + err.Error()
+		} else {
+			missing := []string{}
+			for _, entry := range pool.Maps {
+				if m, _ := rotation.ParseMap(entry); !mapAvailable(available, m) {
+					missing = append(missing, entry)
+				}
+			}
+			if len(missing) > 0 {
+				resp.Warning = "maps of the pool are not available on the server: " + strings.Join(missing, ", ")
+			}
+		}
+	}
+
+	if bundle.Settings != nil {
+		prev, err := s.serverSettings(fullID)
+		if err != nil {
+			return nil, nil, err
+		}
+		next := *bundle.Settings
+		next.Cvars = maps.Clone(bundle.Settings.Cvars)
+		if next.Cvars == nil {
+			next.Cvars = map[string]string{}
+		}
+		if !opts.secrets || bundle.SecretsExcluded {
+			next.RconPassword, next.SvPassword = prev.RconPassword, prev.SvPassword
+		}
+		// The name tells servers apart, so a bundle applied to several
+		// servers doesn't rename them all.
+		if !opts.identity {
+			next.ServerName = prev.ServerName
+		}
+		if err := validateSettings(&next); err != nil {
+			return nil, nil, &bundleError{"settings", err}
+		}
+		resp.Settings = diffSettings(prev, &next)
+		plan.settings = &next
+	}
+
+	return plan, resp, nil
+}
+
+// planFile checks a file of a bundle and compares it with the one on the
+// server.
+func (s *Server) planFile(fullID string, f BundleFile) (BundleChange, bundleWrite, error) {
+	change := BundleChange{Name: f.Path}
+	if f.Path == "" {
+		return change, bundleWrite{}, &bundleError{"file", errors.New("path required")}
+	}
+	p, err := s.files.Resolve(fullID, f.Path, files.Write)
+	if err != nil {
+		return change, bundleWrite{}, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	data, err := files.EncodeText(f.Content, f.Encoding)
+	if err != nil {
+		return change, bundleWrite{}, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	if int64(len(data)) > s.cfg.FilesEditMax {
+		return change, bundleWrite{}, fmt.Errorf("%s: %w", f.Path, files.ErrTooLarge)
+	}
+	write := bundleWrite{path: p, data: data}
+
+	var old string
+	current, err := s.files.ReadFile(fullID, p, s.cfg.FilesEditMax)
+	switch {
+	case errors.Is(err, docker.ErrPathNotFound):
+		change.Action = bundleCreate
+	case err != nil:
+		return change, bundleWrite{}, fmt.Errorf("%s: %w", f.Path, err)
+	case bytes.Equal(current.Data, data):
+		change.Action = bundleUnchanged
+		return change, write, nil
+	default:
+		change.Action = bundleUpdate
+		if old, _, err = files.DecodeText(current.Data); err != nil {
+			// Binary content is replaced without a diff.
+			return change, write, nil
+		}
+	}
+	if diff, err := revisions.Diff([]byte(old), []byte(f.Content), f.Path+" (server)", f.Path+" (bundle)"); err == nil {
+		change.Diff = diff
+	}
+	return change, write, nil
+}
+
+// applyImport makes the changes of a checked bundle. Shared items go first,
+// so the server's rotation and settings find the pools and files they use.
+func (s *Server) applyImport(ctx context.Context, id, fullID string, plan *bundleImport, author string) (*SettingsResponse, string, error) {
+	key := s.serverKey(fullID)
+	for _, pool := range plan.pools {
+		if err := s.rotations.PutPool(pool); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, p := range plan.presets {
+		if err := s.presets.Save(p); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, f := range plan.files {
+		if err := s.writeBundleFile(ctx, fullID, f, author); err != nil {
+			return nil, "", err
+		}
+	}
+	if plan.workshop != nil {
+		if err := s.workshop.Put(key, *plan.workshop); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var warning string
+	if plan.gameModes {
+		if err := s.writeGameModes(ctx, fullID, false); errors.Is(err, errUnmanagedGameModes) {
+			warning = err.Error()
+		} else if err != nil {
+			return nil, "", err
+		}
+	}
+
+	settings := plan.settings
+	if settings == nil {
+		current, err := s.serverSettings(fullID)
+		if err != nil {
+			return nil, "", err
+		}
+		settings = current
+	}
+	applied, err := s.applySettings(id, fullID, author, settings)
+	if err != nil {
+		return nil, "", &bundleError{"settings", err}
+	}
+	// Workshop content is passed as launch arguments.
+	if plan.workshop != nil {
+		applied.Pending = append(applied.Pending, "workshop")
+	}
+
+	if plan.rotation != nil {
+		plan.rotation.LastRotated = time.Now()
+		if err := s.rotations.PutRotation(key, *plan.rotation); err != nil {
+			return nil, "", err
+		}
+	}
+	if warning == "" {
+		warning = applied.Warning
+	}
+	return applied, warning, nil
+}
+
+// writeBundleFile writes a file of a bundle like the text editor does,
+// keeping its mode and owner and recording its history.
+func (s *Server) writeBundleFile(ctx context.Context, fullID string, f bundleWrite, author string) error {
+	defer s.files.Lock(fullID, f.path)()
+
+	mode := int64(defaultFileMode)
+	var uid, gid int
+	current, err := s.files.ReadFile(fullID, f.path, s.cfg.FilesEditMax)
+	switch {
+	case err == nil:
+		mode, uid, gid = current.Mode, current.Uid, current.Gid
+		s.recordBaseline(fullID, f.path, current)
+	case errors.Is(err, docker.ErrPathNotFound):
+		if uid, gid, err = s.files.Owner(ctx, fullID, path.Dir(f.path)); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	if err := s.files.WriteFile(ctx, fullID, f.path, f.data, mode, uid, gid); err != nil {
+		return err
+	}
+	s.recordRevision(fullID, f.path, author, revisions.ActionWrite, f.data)
+	return nil
+}
+
+// samePreset reports whether two presets set the same values.
+func samePreset(a, b *presets.Preset) bool {
+	return a.Description == b.Description && a.GameType == b.GameType && a.GameMode == b.GameMode &&
+		a.MapGroup == b.MapGroup && a.Map == b.Map && maps.Equal(a.Cvars, b.Cvars)
+}
+
+// decodeBundle reads a bundle in JSON or YAML. JSON is valid YAML, so both
+// go through the YAML parser and are then decoded like JSON, with the same
+// field names. Unquoted scalars, such as gameMode: 1, are read as strings
+// wherever the bundle has a string.
+func decodeBundle(data []byte) (*SettingsBundle, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	yamlStrings(&doc, reflect.TypeFor[SettingsBundle]())
+	var v any
+	if err := doc.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	var bundle SettingsBundle
+	if err := json.Unmarshal(j, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	switch {
+	case bundle.Version == 0:
+		return nil, errors.New("not a settings bundle: version missing")
+	case bundle.Version > settingsBundleVersion:
+		return nil, fmt.Errorf("bundle version %d is newer than this panel supports", bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// yamlStrings tags the scalars of node that t, followed through its JSON
+// field names, decodes into strings as strings, and so are mapping keys.
+// Otherwise 30 would stay a number that json can't put into a string.
+func yamlStrings(node *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			yamlStrings(n, t)
+		}
+	case yaml.ScalarNode:
+		if t.Kind() == reflect.String && node.Tag != "!!null" {
+			node.Tag = "!!str"
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, n := range node.Content {
+				yamlStrings(n, t.Elem())
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Kind == yaml.ScalarNode {
+				key.Tag = "!!str"
+			}
+			switch t.Kind() {
+			case reflect.Map:
+				yamlStrings(value, t.Elem())
+			case reflect.Struct:
+				if f, ok := jsonField(t, key.Value); ok {
+					yamlStrings(value, f.Type)
+				}
+			}
+		}
+	}
+}
+
+// jsonField finds the field of struct t that encoding/json decodes the key
+// name into.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	var fold reflect.StructField
+	found := false
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return f, true
+		}
+		if !found && strings.EqualFold(tag, name) {
+			fold, found = f, true
+		}
+	}
+	return fold, found
+}
+
+// bundleYAML writes a bundle as YAML with the field names and order of its
+// JSON form.
+func bundleYAML(bundle *SettingsBundle) ([]byte, error) {
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	plainStyle(&doc)
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// plainStyle drops the flow and quoting styles a node has from being parsed
+// as JSON, so the encoder writes block YAML and quotes only the strings that
+// need it.
+func plainStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		plainStyle(c)
+	}
+}
+
+// importError writes the response for a failed import.
+func (s *Server) importError(w http.ResponseWriter, err error) {
+	var invalid *bundleError
+	if !errors.As(err, &invalid) {
+		s.fileError(w, err)
+		return
+	}
+	var errs cvars.Errors
+	if errors.As(err, &errs) {
+		s.json(w, http.StatusBadRequest, SettingsErrorResponse{Error: "invalid " + invalid.part, Fields: errs})
+		return
+	}
+	s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,613 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/cvars"
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+)
+
+// managedCfg holds the extra cvars of a server, relative to FILES_ROOT. The
+// server runs it at launch with +exec.
+const (
+	managedCfg     = "game/csgo/cfg/cloudstrike.cfg"
+	managedCfgExec = "cloudstrike.cfg"
+)
+
+// settingsTimeout bounds writing the managed config.
+const settingsTimeout = 30 * time.Second
+
+type ServerSettings struct {
+	ServerName   string `json:"serverName"`
+	MaxPlayers   int    `json:"maxPlayers"`
+	Map          string `json:"map"`
+	MapGroup     string `json:"mapGroup"`
+	Tickrate     int    `json:"tickrate"`
+	RconPassword string `json:"rconPassword"`
+	SvPassword   string `json:"svPassword"`
+	GameMode     string `json:"gameMode"`
+	GameType     string `json:"gameType"`
+	// Cvars are further cvars, validated against the schema where it knows
+	// them and written to the managed config.
+	Cvars map[string]string `json:"cvars"`
+}
+
+// SettingsErrorResponse lists what failed validation.
+type SettingsErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields cvars.Errors `json:"fields"`
+}
+
+// SettingsResponse reports how a settings change reached the game. Live
+// fields were pushed over RCON; pending ones take effect when the server is
+// next started or restarted through the panel, which re-creates the
+// container with the new configuration.
+type SettingsResponse struct {
+	ID       string          `json:"id"`
+	Settings *ServerSettings `json:"settings"`
+	Live     []string        `json:"live"`
+	Pending  []string        `json:"pending"`
+	// Restarted is set when the request asked for a restart to apply the
+	// pending fields right away. Fields the restart could not apply stay
+	// pending.
+	Restarted bool   `json:"restarted"`
+	Warning   string `json:"warning,omitempty"`
+}
+
+// settingField describes how one field of ServerSettings reaches the game:
+// through an environment variable of the image read at start and, unless
+// the schema marks its cvar as needing a restart, a console command.
+type settingField struct {
+	name string
+	cvar string
+	env  string
+	// command overrides setting the cvar, for fields applied by other means.
+	command func(value string) string
+	get     func(s *ServerSettings) string
+	set     func(s *ServerSettings, value string)
+}
+
+// liveCommand returns the console command that applies value to a running
+// server, or "" if the field needs a restart.
+func (f settingField) liveCommand(value string) string {
+	if f.command != nil {
+		return f.command(value)
+	}
+	if c, ok := cvars.Default.Lookup(f.cvar); !ok || c.Restart {
+		return ""
+	}
+	return cvars.Command(f.cvar, value)
+}
+
+// Live commands run in this order, so game_type and game_mode are in place
+// before changelevel loads the map with them.
+var settingFields = []settingField{
+	{
+		name: "serverName",
+		cvar: "hostname",
+		env:  "CS2_SERVERNAME",
+		get:  func(s *ServerSettings) string { return s.ServerName },
+		set:  func(s *ServerSettings, v string) { s.ServerName = v },
+	},
+	{
+		name: "maxPlayers",
+		cvar: "maxplayers",
+		env:  "CS2_MAXPLAYERS",
+		get:  func(s *ServerSettings) string { return strconv.Itoa(s.MaxPlayers) },
+		set:  func(s *ServerSettings, v string) { s.MaxPlayers, _ = strconv.Atoi(v) },
+	},
+	{
+		// Tickrate is a launch argument, see serverEnv.
+		name: "tickrate",
+		cvar: "tickrate",
+		get:  func(s *ServerSettings) string { return strconv.Itoa(s.Tickrate) },
+		set:  func(s *ServerSettings, v string) { s.Tickrate, _ = strconv.Atoi(v) },
+	},
+	{
+		name: "rconPassword",
+		cvar: "rcon_password",
+		env:  "CS2_RCONPW",
+		get:  func(s *ServerSettings) string { return s.RconPassword },
+		set:  func(s *ServerSettings, v string) { s.RconPassword = v },
+	},
+	{
+		name: "svPassword",
+		cvar: "sv_password",
+		env:  "CS2_PW",
+		get:  func(s *ServerSettings) string { return s.SvPassword },
+		set:  func(s *ServerSettings, v string) { s.SvPassword = v },
+	},
+	{
+		name: "gameType",
+		cvar: "game_type",
+		env:  "CS2_GAMETYPE",
+		get:  func(s *ServerSettings) string { return s.GameType },
+		set:  func(s *ServerSettings, v string) { s.GameType = v },
+	},
+	{
+		name: "gameMode",
+		cvar: "game_mode",
+		env:  "CS2_GAMEMODE",
+		get:  func(s *ServerSettings) string { return s.GameMode },
+		set:  func(s *ServerSettings, v string) { s.GameMode = v },
+	},
+	{
+		name: "mapGroup",
+		cvar: "mapgroup",
+		env:  "CS2_MAPGROUP",
+		get:  func(s *ServerSettings) string { return s.MapGroup },
+		set:  func(s *ServerSettings, v string) { s.MapGroup = v },
+	},
+	{
+		name:    "map",
+		cvar:    "map",
+		env:     "CS2_STARTMAP",
+		command: func(v string) string { return "changelevel " + v },
+		get:     func(s *ServerSettings) string { return s.Map },
+		set:     func(s *ServerSettings, v string) { s.Map = v },
+	},
+}
+
+// validateSettings checks every field against the cvar schema and brings the
+// values into canonical form.
+func validateSettings(settings *ServerSettings) error {
+	var errs cvars.Errors
+	for _, f := range settingFields {
+		c, _ := cvars.Default.Lookup(f.cvar)
+		v, err := c.Validate(f.get(settings))
+		if err != nil {
+			errs = append(errs, cvars.FieldError{Field: f.name, Message: err.Error()})
+			continue
+		}
+		f.set(settings, v)
+	}
+	if !slices.ContainsFunc(errs, func(e cvars.FieldError) bool { return e.Field == "gameType" || e.Field == "gameMode" }) {
+		if _, ok := cvars.LookupGameMode(settings.GameType, settings.GameMode); !ok {
+			errs = append(errs, cvars.FieldError{
+				Field:   "gameMode",
+				Message: fmt.Sprintf("game_mode %s is not valid with game_type %s", settings.GameMode, settings.GameType),
+			})
+		}
+	}
+
+	extra, extraErrs := cvars.Default.ValidateExtras(settings.Cvars)
+	errs = append(errs, extraErrs...)
+	settings.Cvars = extra
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Settings are keyed by serverKey, so they follow the server across
+// container re-creation.
+var (
+	settingsStore = make(map[string]*ServerSettings)
+	settingsMu    sync.RWMutex
+)
+
+func defaultSettings() *ServerSettings {
+	return &ServerSettings{
+		ServerName:   "CS2 Server",
+		MaxPlayers:   10,
+		Map:          "de_dust2",
+		MapGroup:     "mg_active",
+		Tickrate:     128,
+		RconPassword: "",
+		SvPassword:   "",
+		GameMode:     "1",
+		GameType:     "0",
+		Cvars:        map[string]string{},
+	}
+}
+
+// getSettings returns a copy of the server's settings, or the defaults if
+// none were saved.
+func getSettings(key string) (*ServerSettings, bool) {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	settings, ok := settingsStore[key]
+	if !ok {
+		return defaultSettings(), false
+	}
+	copied := *settings
+	copied.Cvars = maps.Clone(settings.Cvars)
+	return &copied, true
+}
+
+func putSettings(key string, settings *ServerSettings) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	copied := *settings
+	copied.Cvars = maps.Clone(settings.Cvars)
+	settingsStore[key] = &copied
+}
+
+func deleteSettings(key string) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	delete(settingsStore, key)
+}
+
+// serverSettings returns the settings of a server. Servers the panel has no
+// record of, for instance after the panel restarted, are read back from
+// the environment of their container and the managed config.
+func (s *Server) serverSettings(fullID string) (*ServerSettings, error) {
+	key := s.serverKey(fullID)
+	if settings, ok := getSettings(key); ok {
+		return settings, nil
+	}
+	env, err := s.docker.ContainerEnv(fullID)
+	if err != nil {
+		return nil, err
+	}
+	settings := settingsFromEnv(env)
+	if p, err := s.files.Resolve(fullID, managedCfg, files.Read); err == nil {
+		if file, err := s.files.ReadFile(fullID, p, s.cfg.FilesEditMax); err == nil {
+			settings.Cvars = cvars.Parse(file.Data)
+		}
+	}
+	putSettings(key, settings)
+	return settings, nil
+}
+
+func settingsFromEnv(env map[string]string) *ServerSettings {
+	settings := defaultSettings()
+	for _, f := range settingFields {
+		if v, ok := env[f.env]; ok && f.set != nil && v != "" {
+			f.set(settings, v)
+		}
+	}
+	args := strings.Fields(env["CS2_ADDITIONAL_ARGS"])
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-tickrate" {
+			settings.Tickrate, _ = strconv.Atoi(args[i+1])
+		}
+	}
+	return settings
+}
+
+// serverEnv is the container environment that starts the server stored
+// under key with its settings and workshop content.
+func (s *Server) serverEnv(key string, settings *ServerSettings) (map[string]string, error) {
+	ws, err := s.workshop.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for _, f := range settingFields {
+		if f.env != "" {
+			env[f.env] = f.get(settings)
+		}
+	}
+	var args []string
+	if settings.Tickrate > 0 {
+		args = append(args, "-tickrate", strconv.Itoa(settings.Tickrate))
+	}
+	if len(settings.Cvars) > 0 {
+		args = append(args, "+exec", managedCfgExec)
+	}
+	args = append(args, ws.LaunchArgs()...)
+	env["CS2_ADDITIONAL_ARGS"] = strings.Join(args, " ")
+	return env, nil
+}
+
+// pendingEnv returns the variables whose value in the container differs from
+// what the server's configuration asks for.
+func (s *Server) pendingEnv(fullID string) (map[string]string, error) {
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		return nil, err
+	}
+	want, err := s.serverEnv(s.serverKey(fullID), settings)
+	if err != nil {
+		return nil, err
+	}
+	have, err := s.docker.ContainerEnv(fullID)
+	if err != nil {
+		return nil, err
+	}
+	maps.DeleteFunc(want, func(k, v string) bool { return have[k] == v })
+	return want, nil
+}
+
+// startServer starts a stopped server. If its configuration changed since
+// the container was created, the container is re-created first; the data
+// volume carries over. Servers created without a data volume would lose
+// their files, so they start unchanged. It returns the ID of the container
+// that was started and whether it runs the current configuration, which is
+// false when pending settings were left out for want of a data volume.
+func (s *Server) startServer(fullID string) (string, bool, error) {
+	pending, err := s.pendingEnv(fullID)
+	if err != nil {
+		return fullID, false, err
+	}
+	if len(pending) > 0 {
+		labels, err := s.docker.ContainerLabels(fullID)
+		if err != nil {
+			return fullID, false, err
+		}
+		if labels["cloudstrike.volume"] == "" {
+			log.Printf("Server %s has no data volume, starting without applying pending settings", fullID[:12])
+			return fullID, false, s.docker.StartContainer(fullID)
+		}
+		newID, err := s.docker.RecreateGameServer(fullID, pending)
+		if newID == "" {
+			return fullID, false, fmt.Errorf("re-creating the container: %w", err)
+		}
+		if err != nil {
+			log.Printf("Re-created %s as %s: %v", fullID[:12], newID[:12], err)
+		}
+		fullID = newID
+	}
+	return fullID, true, s.docker.StartContainer(fullID)
+}
+
+// writeManagedCfg renders the extra cvars into the managed config and
+// records the change in its revision history, like an edit by author.
+func (s *Server) writeManagedCfg(fullID, author string, values map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), settingsTimeout)
+	defer cancel()
+
+	p, err := s.files.Resolve(fullID, managedCfg, files.Write)
+	if err != nil {
+		return err
+	}
+	defer s.files.Lock(fullID, p)()
+
+	uid, gid, err := s.files.Owner(ctx, fullID, filepath.Dir(p))
+	if err != nil {
+		return err
+	}
+	data := cvars.Render("Managed by Cloud Strike; edit the server settings instead.", values)
+	s.recordBaseline(fullID, p, nil)
+	if err := s.files.WriteFile(ctx, fullID, p, data, 0o644, uid, gid); err != nil {
+		return err
+	}
+	s.recordRevision(fullID, p, author, revisions.ActionWrite, data)
+	return nil
+}
+
+// applySettings validates next, stores it as the server's settings and
+// pushes the changed fields that allow it to the running server over RCON.
+// Everything else is reported as pending. Validation failures are returned
+// as cvars.Errors.
+func (s *Server) applySettings(id, fullID, author string, next *ServerSettings) (*SettingsResponse, error) {
+	if err := validateSettings(next); err != nil {
+		return nil, err
+	}
+	prev, err := s.serverSettings(fullID)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.docker.State(fullID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !maps.Equal(prev.Cvars, next.Cvars) {
+		if err := s.writeManagedCfg(fullID, author, next.Cvars); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", managedCfg, err)
+		}
+	}
+
+	resp := &SettingsResponse{
+		ID:       docker.ServerID(fullID, state.Labels),
+		Settings: next,
+		Live:     []string{},
+		Pending:  []string{},
+	}
+
+	// Connect with the old password, in case this change replaces it.
+	var rconErr error
+	if state.Running {
+		rconErr = s.ensureRCON(id, fullID)
+	}
+	apply := func(name, command string) {
+		if !state.Running || command == "" {
+			resp.Pending = append(resp.Pending, name)
+			return
+		}
+		if rconErr == nil {
+			_, rconErr = s.rcon.Execute(id, command)
+		}
+		if rconErr != nil {
+			resp.Pending = append(resp.Pending, name)
+			return
+		}
+		resp.Live = append(resp.Live, name)
+	}
+
+	// Extra cvars go first, so a map change below already runs with them.
+	for _, name := range slices.Sorted(maps.Keys(next.Cvars)) {
+		value, ok := prev.Cvars[name]
+		if ok && value == next.Cvars[name] {
+			continue
+		}
+		command := cvars.Command(name, next.Cvars[name])
+		if c, known := cvars.Default.Lookup(name); known && c.Restart {
+			command = ""
+		}
+		apply("cvars."+name, command)
+	}
+	// A removed cvar keeps its value until the server restarts.
+	for _, name := range slices.Sorted(maps.Keys(prev.Cvars)) {
+		if _, ok := next.Cvars[name]; !ok {
+			resp.Pending = append(resp.Pending, "cvars."+name)
+		}
+	}
+	for _, f := range settingFields {
+		value := f.get(next)
+		if value == f.get(prev) {
+			continue
+		}
+		apply(f.name, f.liveCommand(value))
+	}
+
+	if rconErr != nil {
+		resp.Warning = "could not apply settings over RCON: " + rconErr.Error()
+	}
+	if len(resp.Pending) > 0 && state.Labels["cloudstrike.volume"] == "" {
+		resp.Warning = "the server has no data volume, so pending settings need it to be created again"
+	}
+
+	putSettings(s.serverKey(fullID), next)
+	return resp, nil
+}
+
+// overlaySettings sets the fields present in the JSON object data. Unlike
+// plain decoding into settings, a cvars object replaces the current extra
+// cvars instead of merging into them.
+func overlaySettings(settings *ServerSettings, data []byte) error {
+	current := settings.Cvars
+	settings.Cvars = nil
+	if err := json.Unmarshal(data, settings); err != nil {
+		settings.Cvars = current
+		return err
+	}
+	if settings.Cvars == nil {
+		settings.Cvars = current
+	}
+	return nil
+}
+
+// settingsError writes the response for a failed applySettings.
+func (s *Server) settingsError(w http.ResponseWriter, err error) {
+	var errs cvars.Errors
+	if errors.As(err, &errs) {
+		s.json(w, http.StatusBadRequest, SettingsErrorResponse{Error: "invalid settings", Fields: errs})
+		return
+	}
+	s.fileError(w, err)
+}
+
+func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, settings)
+}
+
+// handleUpdateSettings overlays the fields in the body on the current
+// settings and applies them. Fields that can't change live wait for the next
+// restart, or trigger one right away with ?restart=true.
+func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := overlaySettings(settings, body); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+
+	resp, err := s.applySettings(id, fullID, s.requestAuthor(r), settings)
+	if err != nil {
+		s.settingsError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("restart") == "true" {
+		if err := s.restartForPending(id, fullID, resp); err != nil {
+			s.json(w, http.StatusInternalServerError, map[string]string{"error": "settings saved, but the restart failed: " + err.Error()})
+			return
+		}
+	}
+
+	s.json(w, http.StatusOK, resp)
+}
+
+// restartForPending restarts a running server that has pending settings, so
+// they take effect right away, and marks them live in resp. If the restart
+// couldn't apply them, they stay pending and resp says why.
+func (s *Server) restartForPending(id, fullID string, resp *SettingsResponse) error {
+	if len(resp.Pending) == 0 {
+		return nil
+	}
+	state, err := s.docker.State(fullID)
+	if err != nil {
+		return err
+	}
+	if !state.Running {
+		return nil
+	}
+	if _, err := s.stopServer(id, fullID, StopRequest{}, false); err != nil {
+		return err
+	}
+	_, applied, err := s.startServer(fullID)
+	if err != nil {
+		return err
+	}
+	resp.Restarted = true
+	if !applied {
+		resp.Warning = "the server was restarted, but it has no data volume, so its container could not be re-created with the pending settings"
+		return nil
+	}
+	resp.Live = append(resp.Live, resp.Pending...)
+	resp.Pending = []string{}
+	return nil
+}
+
+// handleGetCvarSchema describes the cvars the settings API validates, the
+// valid game_type and game_mode pairs and the prefixes extra cvars may have.
+func (s *Server) handleGetCvarSchema(w http.ResponseWriter, r *http.Request) {
+	s.json(w, http.StatusOK, map[string]interface{}{
+		"cvars":         cvars.Default.All(),
+		"gameModes":     cvars.GameModes,
+		"extraPrefixes": cvars.Default.ExtraPrefixes(),
+	})
+}
+
+// patchSettings overlays the fields present in patch on the current settings
+// and applies them like handleUpdateSettings.
+func (s *Server) patchSettings(id, fullID, author string, patch json.RawMessage) (*SettingsResponse, error) {
+	settings, err := s.serverSettings(fullID)
+	if err != nil {
+		return nil, err
+	}
+	if err := overlaySettings(settings, patch); err != nil {
+		return nil, fmt.Errorf("invalid settings patch: %w", err)
+	}
+	return s.applySettings(id, fullID, author, settings)
+}
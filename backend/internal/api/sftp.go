@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chi2l3s/cloudstrike/internal/audit"
+)
+
+// sftpTokenUser lets clients log in with nothing but an API token as the
+// password.
+const sftpTokenUser = "token"
+
+// runSFTP accepts SSH connections on SFTP_ADDR and serves the sftp
+// subsystem on them. Users log in with their name and API token.
+func (s *Server) runSFTP() error {
+	hostKey, err := loadHostKey(s.cfg.SFTPHostKey)
+	if err != nil {
+		return fmt.Errorf("sftp host key: %w", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			user, ok := s.auth.Authenticate(string(password))
+			if !ok || (conn.User() != user.Name && conn.User() != sftpTokenUser) {
+				s.audit.Log(audit.Entry{User: conn.User(), Source: "sftp", Action: "login", Remote: conn.RemoteAddr().String(), Error: "invalid credentials"})
+				return nil, errors.New("invalid credentials")
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"user": user.Name}}, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", s.cfg.SFTPAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("SFTP server listening on %s", s.cfg.SFTPAddr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveSFTPConn(conn, config)
+	}
+}
+
+func (s *Server) serveSFTPConn(conn net.Conn, config *ssh.ServerConfig) {
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	user, ok := s.auth.Lookup(sshConn.Permissions.Extensions["user"])
+	if !ok {
+		return
+	}
+	remote := sshConn.RemoteAddr().String()
+	s.audit.Log(audit.Entry{User: user.Name, Source: "sftp", Action: "login", Remote: remote})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				// The payload of a subsystem request is a length-prefixed name.
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				fs := &sftpFS{s: s, user: user, remote: remote, ctx: ctx}
+				server := sftp.NewRequestServer(channel, sftp.Handlers{
+					FileGet:  fs,
+					FilePut:  fs,
+					FileCmd:  fs,
+					FileList: fs,
+				})
+				if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+					log.Printf("SFTP session of %s ended: %v", user.Name, err)
+				}
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+// loadHostKey reads the SSH host key at path, generating an ed25519 key on
+// first start so that clients see the same fingerprint across restarts.
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "cloudstrike sftp")
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated SFTP host key %s", path)
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(data)
+}
@@ -0,0 +1,471 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/chi2l3s/cloudstrike/internal/audit"
+	"github.com/chi2l3s/cloudstrike/internal/auth"
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/revisions"
+)
+
+// sftpServersTTL is how long a session reuses its list of servers, so that
+// a transfer of many files doesn't list the containers for every request.
+const sftpServersTTL = 10 * time.Second
+
+// sftpFS serves one SFTP session. The root directory holds one directory
+// per server in the user's servers, named after the server; below it lies
+// the server's file root, confined by the same sandbox as the HTTP file API.
+type sftpFS struct {
+	s      *Server
+	user   *auth.User
+	remote string
+	ctx    context.Context
+
+	mu        sync.Mutex
+	known     map[string]string
+	knownTime time.Time
+}
+
+// sftpTarget is an SFTP path mapped onto a server.
+type sftpTarget struct {
+	fullID string
+	name   string
+	// abs is the resolved path inside the container; empty for the
+	// server's directory itself.
+	abs string
+}
+
+// locate maps p onto a server and resolves the rest of it for access.
+// Paths naming the root itself return a nil target.
+func (fs *sftpFS) locate(p string, access files.Access) (*sftpTarget, error) {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil, nil
+	}
+	name, rest, _ := strings.Cut(p, "/")
+
+	fullID, ok := fs.servers()[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	target := &sftpTarget{fullID: fullID, name: name}
+	if rest == "" && access == files.Read {
+		return target, nil
+	}
+	abs, err := fs.s.files.Resolve(fullID, rest, access)
+	if err != nil {
+		return nil, sftpError(err)
+	}
+	target.abs = abs
+	return target, nil
+}
+
+// servers maps the names of the servers visible to the user to their
+// container IDs. The map is shared by the session and must not be changed.
+func (fs *sftpFS) servers() map[string]string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.known != nil && time.Since(fs.knownTime) < sftpServersTTL {
+		return fs.known
+	}
+
+	servers := map[string]string{}
+	containers, err := fs.s.docker.ListContainers()
+	if err != nil {
+		return servers
+	}
+	for _, c := range containers {
+		name := c.Labels["cloudstrike.name"]
+		if name != "" && fs.user.HasServer(c.ID, docker.ServerID(c.ID, c.Labels)) {
+			servers[name] = c.ID
+		}
+	}
+	fs.known, fs.knownTime = servers, time.Now()
+	return servers
+}
+
+func (fs *sftpFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	target, err := fs.locate(r.Filepath, files.Read)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil || target.abs == "" {
+		return nil, sftp.ErrSSHFxFailure
+	}
+
+	f, _, err := fs.s.files.Stage(target.fullID, target.abs)
+	fs.log("download", target, r.Filepath, "", err)
+	if err != nil {
+		return nil, sftpError(err)
+	}
+	return &stagedFile{File: f}, nil
+}
+
+// Filewrite stages the upload in a temporary file that is atomically copied
+// into the container when the client closes it. Files opened without
+// truncation start from their current content, so resumed uploads and
+// writes at offsets work.
+func (fs *sftpFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	target, err := fs.locate(r.Filepath, files.Write)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil || target.abs == "" {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	flags := r.Pflags()
+	stat, err := fs.s.docker.StatPath(target.fullID, target.abs)
+	exists := err == nil
+	switch {
+	case err != nil && !errors.Is(err, docker.ErrPathNotFound):
+		return nil, err
+	case exists && stat.Mode.IsDir():
+		return nil, sftp.ErrSSHFxFailure
+	case exists && flags.Excl:
+		return nil, os.ErrExist
+	}
+
+	var tmp *os.File
+	if exists && !flags.Trunc {
+		tmp, _, err = fs.s.files.Stage(target.fullID, target.abs)
+	} else {
+		tmp, err = os.CreateTemp("", "cloudstrike-stage-*")
+	}
+	if err != nil {
+		return nil, sftpError(err)
+	}
+	return &sftpUpload{fs: fs, target: target, vpath: r.Filepath, file: tmp, existed: exists, mode: stat.Mode.Perm()}, nil
+}
+
+func (fs *sftpFS) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		return fs.setstat(r)
+	case "Rename", "PosixRename":
+		return fs.rename(r, r.Method == "PosixRename")
+	case "Mkdir":
+		return fs.command("mkdir", r.Filepath, files.Write, fs.s.files.Mkdir)
+	case "Rmdir":
+		return fs.command("rmdir", r.Filepath, files.Modify, fs.s.files.Rmdir)
+	case "Remove":
+		return fs.command("delete", r.Filepath, files.Modify, func(ctx context.Context, fullID, p string) error {
+			isDir, err := fs.s.files.IsDir(fullID, p)
+			if err != nil {
+				return err
+			}
+			if isDir {
+				return files.ErrNotRegular
+			}
+			return fs.s.files.Remove(ctx, fullID, p)
+		})
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// PosixRename replaces an existing target, unlike the plain SFTP rename.
+func (fs *sftpFS) PosixRename(r *sftp.Request) error {
+	return fs.rename(r, true)
+}
+
+func (fs *sftpFS) command(action, p string, access files.Access, run func(ctx context.Context, fullID, p string) error) error {
+	target, err := fs.locate(p, access)
+	if err != nil {
+		return err
+	}
+	if target == nil || target.abs == "" {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+
+	ctx, cancel := context.WithTimeout(fs.ctx, fileOpTimeout)
+	defer cancel()
+	err = run(ctx, target.fullID, target.abs)
+	fs.log(action, target, p, "", err)
+	return sftpError(err)
+}
+
+// setstat applies permission changes. Times and owners are accepted and
+// ignored so that clients preserving them don't fail the transfer.
+func (fs *sftpFS) setstat(r *sftp.Request) error {
+	flags := r.AttrFlags()
+	if flags.Size {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	if !flags.Permissions {
+		return nil
+	}
+	mode := r.Attributes().Mode & 0o7777
+	return fs.command("chmod", r.Filepath, files.Write, func(ctx context.Context, fullID, p string) error {
+		return fs.s.files.Chmod(ctx, fullID, p, mode, false)
+	})
+}
+
+func (fs *sftpFS) rename(r *sftp.Request, overwrite bool) error {
+	src, err := fs.locate(r.Filepath, files.Modify)
+	if err != nil {
+		return err
+	}
+	dst, err := fs.locate(r.Target, files.Write)
+	if err != nil {
+		return err
+	}
+	if src == nil || dst == nil || src.abs == "" || dst.abs == "" {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	if src.fullID != dst.fullID {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(fs.ctx, fileOpTimeout)
+	defer cancel()
+	if overwrite {
+		fs.s.recordBaseline(dst.fullID, dst.abs, nil)
+	}
+	err = fs.s.files.Move(ctx, src.fullID, src.abs, dst.abs, overwrite)
+	fs.log("move", src, r.Filepath, r.Target, err)
+	if err == nil {
+		fs.s.recordFile(dst.fullID, dst.abs, fs.user.Name, revisions.ActionMove)
+	}
+	return sftpError(err)
+}
+
+func (fs *sftpFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	target, err := fs.locate(r.Filepath, files.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Method {
+	case "List":
+		if target == nil {
+			var list listerAt
+			for name := range fs.servers() {
+				list = append(list, dirInfo(name))
+			}
+			return list, nil
+		}
+		dir := target.abs
+		if dir == "" {
+			if dir, err = fs.s.files.Resolve(target.fullID, "", files.Read); err != nil {
+				return nil, sftpError(err)
+			}
+		}
+		ctx, cancel := context.WithTimeout(fs.ctx, fileExecTimeout)
+		defer cancel()
+		entries, err := fs.s.files.List(ctx, target.fullID, dir)
+		fs.log("list", target, r.Filepath, "", err)
+		if err != nil {
+			return nil, sftpError(err)
+		}
+		list := make(listerAt, 0, len(entries))
+		for _, e := range entries {
+			list = append(list, entryInfo(e))
+		}
+		return list, nil
+
+	case "Stat":
+		if target == nil {
+			return listerAt{dirInfo("/")}, nil
+		}
+		if target.abs == "" {
+			fs.log("stat", target, r.Filepath, "", nil)
+			return listerAt{dirInfo(target.name)}, nil
+		}
+		stat, err := fs.s.docker.StatPath(target.fullID, target.abs)
+		fs.log("stat", target, r.Filepath, "", err)
+		if err != nil {
+			return nil, sftpError(err)
+		}
+		return listerAt{&fileInfo{name: path.Base(r.Filepath), size: stat.Size, mode: stat.Mode, modTime: stat.Mtime}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// Readlink shows the target of a symlink as a path in the SFTP tree when it
+// points inside the server's root.
+func (fs *sftpFS) Readlink(p string) (string, error) {
+	target, err := fs.locate(p, files.Modify)
+	if err != nil {
+		return "", err
+	}
+	if target == nil || target.abs == "" {
+		return "", os.ErrInvalid
+	}
+	stat, err := fs.s.docker.StatPath(target.fullID, target.abs)
+	fs.log("readlink", target, p, "", err)
+	if err != nil {
+		return "", sftpError(err)
+	}
+	if stat.Mode&os.ModeSymlink == 0 {
+		return "", os.ErrInvalid
+	}
+	policy, err := fs.s.files.Policy(target.fullID)
+	if err != nil {
+		return "", err
+	}
+	link := stat.LinkTarget
+	if rel, ok := strings.CutPrefix(path.Clean(link), path.Clean(policy.Root)+"/"); ok && path.IsAbs(link) {
+		return "/" + target.name + "/" + rel, nil
+	}
+	return link, nil
+}
+
+func (fs *sftpFS) log(action string, target *sftpTarget, p, dst string, err error) {
+	e := audit.Entry{
+		User:   fs.user.Name,
+		Source: "sftp",
+		Action: action,
+		Server: target.fullID[:12],
+		Path:   p,
+		Target: dst,
+		Remote: fs.remote,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	fs.s.audit.Log(e)
+}
+
+// sftpUpload collects an upload on the panel host.
+type sftpUpload struct {
+	fs      *sftpFS
+	target  *sftpTarget
+	vpath   string
+	file    *os.File
+	existed bool
+	mode    os.FileMode
+}
+
+func (u *sftpUpload) WriteAt(p []byte, off int64) (int, error) {
+	return u.file.WriteAt(p, off)
+}
+
+// Close copies the upload into the container. Replaced files keep their
+// mode and owner; new ones get the owner of their directory.
+func (u *sftpUpload) Close() error {
+	defer os.Remove(u.file.Name())
+	defer u.file.Close()
+
+	err := u.commit()
+	u.fs.log("upload", u.target, u.vpath, "", err)
+	return sftpError(err)
+}
+
+func (u *sftpUpload) commit() error {
+	fs, fullID, p := u.fs, u.target.fullID, u.target.abs
+
+	info, err := u.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := u.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	unlock := fs.s.files.Lock(fullID, p)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(fs.ctx, fileOpTimeout)
+	defer cancel()
+
+	mode := int64(defaultFileMode)
+	owned := path.Dir(p)
+	if u.existed {
+		mode, owned = int64(u.mode), p
+	}
+	uid, gid, err := fs.s.files.Owner(ctx, fullID, owned)
+	if err != nil {
+		return err
+	}
+
+	if u.existed {
+		fs.s.recordBaseline(fullID, p, nil)
+	}
+	if err := fs.s.files.WriteFileFrom(ctx, fullID, p, u.file, info.Size(), mode, uid, gid); err != nil {
+		return err
+	}
+	fs.s.recordFile(fullID, p, fs.user.Name, revisions.ActionUpload)
+	return nil
+}
+
+// stagedFile is a downloaded file that is removed once the client closes it.
+type stagedFile struct {
+	*os.File
+}
+
+func (f *stagedFile) Close() error {
+	defer os.Remove(f.Name())
+	return f.File.Close()
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(dst []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(dst, l[offset:])
+	if n < len(dst) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func dirInfo(name string) os.FileInfo {
+	return &fileInfo{name: name, mode: os.ModeDir | 0o755, modTime: time.Now()}
+}
+
+func entryInfo(e files.Entry) os.FileInfo {
+	perm, _ := strconv.ParseUint(e.Mode, 8, 32)
+	mode := os.FileMode(perm) & os.ModePerm
+	switch e.Type {
+	case files.TypeDir:
+		mode |= os.ModeDir
+	case files.TypeSymlink:
+		mode |= os.ModeSymlink
+	case files.TypeOther:
+		mode |= os.ModeIrregular
+	}
+	return &fileInfo{name: e.Name, size: e.Size, mode: mode, modTime: e.ModTime}
+}
+
+// sftpError turns sandbox errors into the status codes SFTP clients expect.
+func sftpError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, docker.ErrPathNotFound):
+		return os.ErrNotExist
+	case errors.Is(err, files.ErrOutsideRoot), errors.Is(err, files.ErrReadOnly), errors.Is(err, files.ErrIsRoot):
+		return sftp.ErrSSHFxPermissionDenied
+	case errors.Is(err, files.ErrExists):
+		return os.ErrExist
+	}
+	return err
+}
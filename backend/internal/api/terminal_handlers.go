@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Access is gated by API tokens rather than origin, matching the CORS policy.
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// TerminalMessage is a control frame sent by the client as JSON text.
+// Binary frames are written to the shell's stdin unchanged.
+type TerminalMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols uint   `json:"cols,omitempty"`
+	Rows uint   `json:"rows,omitempty"`
+}
+
+func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	fullID, err := s.docker.GetContainerByPrefix(id)
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	cols, _ := strconv.ParseUint(r.URL.Query().Get("cols"), 10, 16)
+	rows, _ := strconv.ParseUint(r.URL.Query().Get("rows"), 10, 16)
+
+	session, err := s.docker.ExecTTY(fullID, []string{s.cfg.TerminalShell}, uint(cols), uint(rows))
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer session.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	user, _ := userFromContext(r.Context())
+	log.Printf("Terminal opened on %s by %s", id, user.Name)
+	defer log.Printf("Terminal closed on %s by %s", id, user.Name)
+
+	var lastActivity atomic.Int64
+	touch := func() { lastActivity.Store(time.Now().UnixNano()) }
+	touch()
+
+	done := make(chan struct{})
+
+	// Shell output -> browser. This goroutine is the only data writer.
+	go func() {
+		defer close(done)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := session.Conn.Reader.Read(buf)
+			if n > 0 {
+				touch()
+				if werr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shell exited"),
+					time.Now().Add(time.Second))
+				return
+			}
+		}
+	}()
+
+	// Browser input -> shell.
+	go func() {
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				session.Close()
+				return
+			}
+			touch()
+
+			if msgType == websocket.BinaryMessage {
+				session.Conn.Conn.Write(data)
+				continue
+			}
+
+			var msg TerminalMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				session.Conn.Conn.Write([]byte(msg.Data))
+			case "resize":
+				if msg.Cols > 0 && msg.Rows > 0 {
+					s.docker.ResizeExec(session.ExecID, msg.Cols, msg.Rows)
+				}
+			}
+		}
+	}()
+
+	checkEvery := time.Minute
+	if t := s.cfg.TerminalIdleTimeout; t > 0 && t/2 < checkEvery {
+		checkEvery = t / 2
+	}
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			idle := time.Since(time.Unix(0, lastActivity.Load()))
+			if s.cfg.TerminalIdleTimeout > 0 && idle > s.cfg.TerminalIdleTimeout {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "idle timeout"),
+					time.Now().Add(time.Second))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/files"
+	"github.com/chi2l3s/cloudstrike/internal/workshop"
+)
+
+// workshopTimeout bounds the metadata lookups and disk scans of one request.
+const workshopTimeout = 30 * time.Second
+
+type WorkshopResponse struct {
+	workshop.Config
+	// LaunchArgs are the srcds arguments for the attached content.
+	LaunchArgs []string `json:"launchArgs"`
+	// Items is the metadata of the attached maps and collection, when the
+	// metadata source is reachable.
+	Items   []workshop.Item `json:"items"`
+	Warning string          `json:"warning,omitempty"`
+}
+
+type WorkshopDownload struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+	// Maps lists the files of the item, usually a single .vpk.
+	Maps     []string  `json:"maps"`
+	ModTime  time.Time `json:"modTime"`
+	Attached bool      `json:"attached"`
+}
+
+type WorkshopDownloadsResponse struct {
+	Downloads []WorkshopDownload `json:"downloads"`
+	TotalSize int64              `json:"totalSize"`
+	Warning   string             `json:"warning,omitempty"`
+}
+
+type WorkshopPruneResponse struct {
+	DryRun  bool             `json:"dryRun"`
+	Removed []string         `json:"removed"`
+	Freed   int64            `json:"freed"`
+	Failed  []WorkshopFailed `json:"failed"`
+}
+
+type WorkshopFailed struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+func (s *Server) handleGetWorkshop(w http.ResponseWriter, r *http.Request) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	cfg, err := s.workshop.Get(s.serverKey(fullID))
+	if err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	resp := WorkshopResponse{Config: cfg, LaunchArgs: cfg.LaunchArgs(), Items: []workshop.Item{}}
+	if ids := workshopIDs(cfg); len(ids) > 0 {
+		if items, err := s.steam.Items(ctx, ids); err != nil {
+			resp.Warning = "workshop metadata unavailable: " + err.Error()
+		} else {
+			resp.Items = items
+		}
+	}
+	s.json(w, http.StatusOK, resp)
+}
+
+// handleUpdateWorkshop replaces the workshop content attached to the server.
+// The content is checked against the metadata source; if the source can't
+// be reached the config is saved unchecked and the response carries a
+// warning.
+// The content reaches the game through the launch arguments in the
+// container's environment, so it takes effect when the panel next starts or
+// restarts the server and re-creates its container. Servers without a data
+// volume are never re-created and keep their old arguments.
+func (s *Server) handleUpdateWorkshop(w http.ResponseWriter, r *http.Request) {
+	var cfg workshop.Config
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	maps := []string{}
+	for _, id := range cfg.Maps {
+		if !slices.Contains(maps, id) {
+			maps = append(maps, id)
+		}
+	}
+	cfg.Maps = maps
+
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	resp := WorkshopResponse{Config: cfg, LaunchArgs: cfg.LaunchArgs(), Items: []workshop.Item{}}
+	items, err := workshop.Check(ctx, s.steam, cfg)
+	var itemErr *workshop.ItemError
+	switch {
+	case errors.As(err, &itemErr):
+		s.json(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		resp.Warning = err.Error() + "; IDs were not verified"
+	default:
+		resp.Items = items
+	}
+
+	if err := s.workshop.Put(s.serverKey(fullID), cfg); err != nil {
+		s.json(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.json(w, http.StatusOK, resp)
+}
+
+// handleListWorkshopDownloads lists the items in WORKSHOP_DIR with their
+// size on disk and whether the server's config still uses them.
+func (s *Server) handleListWorkshopDownloads(w http.ResponseWriter, r *http.Request) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	downloads, err := s.workshopDownloads(ctx, fullID)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	resp := WorkshopDownloadsResponse{Downloads: downloads}
+	attached, err := s.attachedWorkshopItems(ctx, fullID)
+	if err != nil {
+		resp.Warning = err.Error()
+	}
+	ids := make([]string, 0, len(downloads))
+	for i := range downloads {
+		downloads[i].Attached = attached[downloads[i].ID]
+		resp.TotalSize += downloads[i].Size
+		ids = append(ids, downloads[i].ID)
+	}
+
+	if len(ids) > 0 {
+		if items, err := s.steam.Items(ctx, ids); err == nil {
+			for _, item := range items {
+				if i := slices.IndexFunc(downloads, func(d WorkshopDownload) bool { return d.ID == item.ID }); i >= 0 {
+					downloads[i].Title = item.Title
+				}
+			}
+		} else if resp.Warning == "" {
+			resp.Warning = "workshop metadata unavailable: " + err.Error()
+		}
+	}
+	s.json(w, http.StatusOK, resp)
+}
+
+// handleDeleteWorkshopDownload removes one downloaded item. Items the server
+// is configured to use are refused, since the game would fetch them again.
+func (s *Server) handleDeleteWorkshopDownload(w http.ResponseWriter, r *http.Request) {
+	itemID := r.PathValue("itemId")
+	if _, err := strconv.ParseUint(itemID, 10, 64); err != nil {
+		s.json(w, http.StatusBadRequest, map[string]string{"error": workshop.ErrBadID.Error()})
+		return
+	}
+
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	// A collection that can't be expanded only hides its own items; maps
+	// attached directly are still protected.
+	attached, _ := s.attachedWorkshopItems(ctx, fullID)
+	if attached[itemID] {
+		s.json(w, http.StatusConflict, map[string]string{"error": "workshop item is attached to the server"})
+		return
+	}
+
+	if err := s.removeWorkshopDownload(ctx, fullID, itemID); err != nil {
+		s.fileError(w, err)
+		return
+	}
+	s.json(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handlePruneWorkshop removes every download the server's config no longer
+// uses. With dryRun=true it only reports what would be removed. It refuses
+// to run while the attached collection can't be expanded, as that would
+// delete the collection's maps.
+func (s *Server) handlePruneWorkshop(w http.ResponseWriter, r *http.Request) {
+	fullID, err := s.docker.GetContainerByPrefix(r.PathValue("id"))
+	if err != nil || fullID == "" {
+		s.json(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workshopTimeout)
+	defer cancel()
+
+	attached, err := s.attachedWorkshopItems(ctx, fullID)
+	if err != nil {
+		s.json(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	downloads, err := s.workshopDownloads(ctx, fullID)
+	if err != nil {
+		s.fileError(w, err)
+		return
+	}
+
+	resp := WorkshopPruneResponse{
+		DryRun:  r.URL.Query().Get("dryRun") == "true",
+		Removed: []string{},
+		Failed:  []WorkshopFailed{},
+	}
+	for _, d := range downloads {
+		if attached[d.ID] {
+			continue
+		}
+		if !resp.DryRun {
+			if err := s.removeWorkshopDownload(ctx, fullID, d.ID); err != nil {
+				resp.Failed = append(resp.Failed, WorkshopFailed{ID: d.ID, Error: err.Error()})
+				continue
+			}
+		}
+		resp.Removed = append(resp.Removed, d.ID)
+		resp.Freed += d.Size
+	}
+
+	status := http.StatusOK
+	if len(resp.Failed) > 0 {
+		status = http.StatusMultiStatus
+	}
+	s.json(w, status, resp)
+}
+
+// workshopDownloads returns the items in WORKSHOP_DIR. Entries that aren't
+// workshop IDs are skipped.
+func (s *Server) workshopDownloads(ctx context.Context, fullID string) ([]WorkshopDownload, error) {
+	dir, err := s.files.Resolve(fullID, s.cfg.WorkshopDir, files.Read)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.files.DirUsage(ctx, fullID, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	downloads := []WorkshopDownload{}
+	for _, u := range usage {
+		if _, err := strconv.ParseUint(u.Name, 10, 64); err != nil {
+			continue
+		}
+		downloads = append(downloads, WorkshopDownload{
+			ID:      u.Name,
+			Size:    u.Size,
+			Files:   u.Files,
+			Maps:    u.Names,
+			ModTime: u.ModTime,
+		})
+	}
+	return downloads, nil
+}
+
+// removeWorkshopDownload deletes the directory of one item. WORKSHOP_DIR is
+// below the read-only game/bin by default, so the path is resolved for
+// reading and removed here rather than through the generic file routes.
+func (s *Server) removeWorkshopDownload(ctx context.Context, fullID, itemID string) error {
+	p, err := s.files.Resolve(fullID, path.Join(s.cfg.WorkshopDir, itemID), files.Read)
+	if err != nil {
+		return err
+	}
+	if _, err := s.docker.StatPath(fullID, p); err != nil {
+		return err
+	}
+	return s.files.Remove(ctx, fullID, p)
+}
+
+// attachedWorkshopItems returns the IDs the server's config uses. If the
+// collection can't be expanded, the IDs attached directly are returned
+// along with the error.
+func (s *Server) attachedWorkshopItems(ctx context.Context, fullID string) (map[string]bool, error) {
+	cfg, err := s.workshop.Get(s.serverKey(fullID))
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	attached, err := workshop.Attached(ctx, s.steam, cfg)
+	if err != nil {
+		direct, _ := workshop.Attached(ctx, s.steam, workshop.Config{Maps: cfg.Maps, StartMap: cfg.StartMap})
+		return direct, fmt.Errorf("cannot expand workshop collection %s: %w", cfg.Collection, err)
+	}
+	return attached, nil
+}
+
+// workshopIDs lists the collection and maps of cfg without duplicates.
+func workshopIDs(cfg workshop.Config) []string {
+	var ids []string
+	for _, id := range append([]string{cfg.Collection, cfg.StartMap}, cfg.Maps...) {
+		if id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is one audited action.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Source string    `json:"source"`
+	Action string    `json:"action"`
+	Server string    `json:"server,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	Target string    `json:"target,omitempty"`
+	Remote string    `json:"remote,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Logger appends entries as JSON lines to a file and echoes them to the
+// standard log.
+type Logger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open appends to the file at path, creating it if needed. An empty path
+// yields a logger that only writes to the standard log.
+func Open(path string) (*Logger, error) {
+	if path == "" {
+		return &Logger{}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{file: f}, nil
+}
+
+func (l *Logger) Log(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	msg := e.Action
+	if e.Path != "" {
+		msg += " " + e.Path
+	}
+	if e.Target != "" {
+		msg += " -> " + e.Target
+	}
+	if e.Error != "" {
+		msg += ": " + e.Error
+	}
+	if e.Server != "" {
+		msg = e.Server + ": " + msg
+	}
+	log.Printf("Audit [%s] %s: %s", e.Source, e.User, msg)
+
+	if l.file == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
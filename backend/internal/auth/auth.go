@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Permission string
+
+const (
+	PermAll      Permission = "*"
+	PermTerminal Permission = "terminal"
+	PermConsole  Permission = "console"
+	PermExec     Permission = "exec"
+	PermJobs     Permission = "jobs"
+	PermSecrets  Permission = "secrets"
+)
+
+// User is an operator allowed to use the gated parts of the API.
+// Servers lists container ID prefixes the user may act on; "*" means all.
+// A recreated server is also matched by the 12 character ID of the
+// container it replaced.
+type User struct {
+	Name        string       `json:"name"`
+	Token       string       `json:"token"`
+	Permissions []Permission `json:"permissions"`
+	Servers     []string     `json:"servers"`
+}
+
+type Store struct {
+	users []User
+}
+
+// Load reads users from a JSON file containing an array of User. An empty
+// path yields a store without users, which denies every gated request.
+func Load(path string) (*Store, error) {
+	if path == "" {
+		return &Store{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read auth file: %w", err)
+	}
+
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("parse auth file: %w", err)
+	}
+
+	for i, u := range users {
+		if u.Name == "" || u.Token == "" {
+			return nil, fmt.Errorf("auth file: user %d needs a name and a token", i)
+		}
+	}
+
+	return &Store{users: users}, nil
+}
+
+func (s *Store) Authenticate(token string) (*User, bool) {
+	if token == "" {
+		return nil, false
+	}
+	for i := range s.users {
+		if subtle.ConstantTimeCompare([]byte(s.users[i].Token), []byte(token)) == 1 {
+			return &s.users[i], true
+		}
+	}
+	return nil, false
+}
+
+// Lookup returns the user called name.
+func (s *Store) Lookup(name string) (*User, bool) {
+	for i := range s.users {
+		if s.users[i].Name == name {
+			return &s.users[i], true
+		}
+	}
+	return nil, false
+}
+
+// Can reports whether the user holds perm for a server, given the IDs it is
+// known by: its container ID and the server ID it inherited, if any.
+func (u *User) Can(perm Permission, ids ...string) bool {
+	return u.hasPermission(perm) && u.HasServer(ids...)
+}
+
+func (u *User) hasPermission(perm Permission) bool {
+	for _, p := range u.Permissions {
+		if p == PermAll || p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasServer reports whether the user may act on a server at all, given the
+// IDs it is known by.
+func (u *User) HasServer(ids ...string) bool {
+	for _, prefix := range u.Servers {
+		if prefix == "*" {
+			return true
+		}
+		if prefix == "" {
+			continue
+		}
+		for _, id := range ids {
+			if strings.HasPrefix(id, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,7 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -9,14 +14,195 @@ type Config struct {
 	DatabaseURL string
 	JWTSecret   string
 	DockerHost  string
+	AuthFile    string
+
+	TerminalShell       string
+	TerminalIdleTimeout time.Duration
+
+	ExecTimeout    time.Duration
+	ExecMaxTimeout time.Duration
+	ExecMaxOutput  int64
+
+	StopTimeout         time.Duration
+	StopCountdown       time.Duration
+	StopWarnAt          []int
+	StopPreCommands     []string
+	StopMatchEndTimeout time.Duration
+
+	BulkConcurrency int
+
+	FilesRoot     string
+	FilesReadOnly []string
+	FilesEditMax  int64
+	// FilesSearchTimeout bounds one file search request.
+	FilesSearchTimeout time.Duration
+
+	DataDir       string
+	UploadTTL     time.Duration
+	UploadMaxSize int64
+
+	// RevisionsMax is how many revisions are kept per config file.
+	RevisionsMax int
+
+	AuditLog string
+
+	// MetricsToken must be sent as a bearer token to scrape /metrics. It is
+	// opt-in: unset or empty disables the endpoint.
+	MetricsToken string
+
+	// SFTPAddr is where the SFTP server listens. It is opt-in: unset or
+	// empty disables it.
+	SFTPAddr    string
+	SFTPHostKey string
+
+	// WorkshopDir is where the game downloads workshop items, relative to
+	// FilesRoot.
+	WorkshopDir    string
+	WorkshopAPIURL string
+	// WorkshopMock is a JSON file of workshop items served instead of the
+	// Steam API.
+	WorkshopMock string
+
+	// MapsDir holds the map .vpk files, relative to FilesRoot.
+	MapsDir string
+	// RotationCheckInterval is how often scheduled map rotations are checked.
+	RotationCheckInterval time.Duration
+
+	// ServerPortMin and ServerPortMax bound the ports given to servers
+	// created without one, such as clones.
+	ServerPortMin int
+	ServerPortMax int
+	// ClonePaths are the config and plugin paths, relative to FilesRoot,
+	// copied into a clone unless its whole volume is copied.
+	ClonePaths []string
+
+	// ExtraCvarPrefixes replace the name prefixes unknown extra cvars must
+	// have; nil keeps cvars.DefaultExtraPrefixes.
+	ExtraCvarPrefixes []string
 }
 
 func Load() (*Config, error) {
+	terminalIdleTimeout, err := getEnvDuration("TERMINAL_IDLE_TIMEOUT", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	execTimeout, err := getEnvDuration("EXEC_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	rotationCheckInterval, err := getEnvDuration("ROTATION_CHECK_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if rotationCheckInterval <= 0 {
+		return nil, fmt.Errorf("invalid ROTATION_CHECK_INTERVAL: must be positive")
+	}
+	execMaxTimeout, err := getEnvDuration("EXEC_MAX_TIMEOUT", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	execMaxOutput, err := getEnvInt64("EXEC_MAX_OUTPUT", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	stopTimeout, err := getEnvDuration("STOP_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	stopCountdown, err := getEnvDuration("STOP_COUNTDOWN", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	stopWarnAt, err := getEnvInts("STOP_WARN_AT", []int{60, 30, 10, 5, 4, 3, 2, 1})
+	if err != nil {
+		return nil, err
+	}
+	stopMatchEndTimeout, err := getEnvDuration("STOP_MATCH_END_TIMEOUT", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	bulkConcurrency, err := getEnvInt64("BULK_CONCURRENCY", 4)
+	if err != nil {
+		return nil, err
+	}
+	filesEditMax, err := getEnvInt64("FILES_EDIT_MAX_SIZE", 2<<20)
+	if err != nil {
+		return nil, err
+	}
+	filesSearchTimeout, err := getEnvDuration("FILES_SEARCH_TIMEOUT", 20*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	uploadTTL, err := getEnvDuration("UPLOAD_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	uploadMaxSize, err := getEnvInt64("UPLOAD_MAX_SIZE", 10<<30)
+	if err != nil {
+		return nil, err
+	}
+	revisionsMax, err := getEnvInt64("REVISIONS_MAX", 100)
+	if err != nil {
+		return nil, err
+	}
+	serverPortMin, serverPortMax, err := getEnvRange("SERVER_PORTS", 27015, 27099)
+	if err != nil {
+		return nil, err
+	}
+	dataDir := getEnv("DATA_DIR", "data")
+
 	return &Config{
 		Port:        getEnv("PORT", "8080"),
 		DatabaseURL: getEnv("DATABASE_URL", "postgres://localhost:5432/cloudstrike?sslmode=disable"),
 		JWTSecret:   getEnv("JWT_SECRET", "change-me-in-production"),
 		DockerHost:  getEnv("DOCKER_HOST", ""),
+		AuthFile:    getEnv("AUTH_FILE", ""),
+
+		TerminalShell:       getEnv("TERMINAL_SHELL", "/bin/bash"),
+		TerminalIdleTimeout: terminalIdleTimeout,
+
+		ExecTimeout:    execTimeout,
+		ExecMaxTimeout: execMaxTimeout,
+		ExecMaxOutput:  execMaxOutput,
+
+		StopTimeout:         stopTimeout,
+		StopCountdown:       stopCountdown,
+		StopWarnAt:          stopWarnAt,
+		StopPreCommands:     getEnvList("STOP_PRE_COMMANDS", ";", nil),
+		StopMatchEndTimeout: stopMatchEndTimeout,
+
+		BulkConcurrency: int(bulkConcurrency),
+
+		FilesRoot:          getEnv("FILES_ROOT", "/home/steam/cs2-dedicated"),
+		FilesReadOnly:      getEnvList("FILES_READONLY", ",", []string{"game/bin", "game/csgo/bin", "game/cs2.sh", "steamapps"}),
+		FilesEditMax:       filesEditMax,
+		FilesSearchTimeout: filesSearchTimeout,
+
+		DataDir:       dataDir,
+		UploadTTL:     uploadTTL,
+		UploadMaxSize: uploadMaxSize,
+
+		RevisionsMax: int(revisionsMax),
+
+		AuditLog: getEnv("AUDIT_LOG", filepath.Join(dataDir, "audit.log")),
+
+		MetricsToken: os.Getenv("METRICS_TOKEN"),
+
+		SFTPAddr:    os.Getenv("SFTP_ADDR"),
+		SFTPHostKey: getEnv("SFTP_HOST_KEY", filepath.Join(dataDir, "sftp_host_ed25519_key")),
+
+		WorkshopDir:    getEnv("WORKSHOP_DIR", "game/bin/linuxsteamrt64/steamapps/workshop/content/730"),
+		WorkshopAPIURL: getEnv("WORKSHOP_API_URL", "https://api.steampowered.com"),
+		WorkshopMock:   getEnv("WORKSHOP_MOCK", ""),
+
+		MapsDir:               getEnv("MAPS_DIR", "game/csgo/maps"),
+		RotationCheckInterval: rotationCheckInterval,
+
+		ServerPortMin: serverPortMin,
+		ServerPortMax: serverPortMax,
+		ClonePaths:    getEnvList("CLONE_PATHS", ",", []string{"game/csgo/cfg", "game/csgo/addons", "game/csgo/gamemodes_server.txt"}),
+
+		ExtraCvarPrefixes: getEnvList("EXTRA_CVAR_PREFIXES", ",", nil),
 	}, nil
 }
 
@@ -26,3 +212,72 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func getEnvInt64(key string, defaultValue int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func getEnvList(key, sep string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvRange parses a port range such as 27015-27099.
+func getEnvRange(key string, defaultMin, defaultMax int) (int, int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultMin, defaultMax, nil
+	}
+	lo, hi, ok := strings.Cut(value, "-")
+	first, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	last, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if !ok || err1 != nil || err2 != nil || first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid %s: must be a range like 27015-27099", key)
+	}
+	return first, last, nil
+}
+
+func getEnvInts(key string, defaultValue []int) ([]int, error) {
+	items := getEnvList(key, ",", nil)
+	if items == nil {
+		return defaultValue, nil
+	}
+	list := make([]int, 0, len(items))
+	for _, item := range items {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
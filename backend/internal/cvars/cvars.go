@@ -0,0 +1,319 @@
+package cvars
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Type string
+
+const (
+	Bool   Type = "bool"
+	Int    Type = "int"
+	Float  Type = "float"
+	String Type = "string"
+	Enum   Type = "enum"
+)
+
+// Cvar describes one console variable of the game.
+type Cvar struct {
+	Name string `json:"name"`
+	Type Type   `json:"type"`
+	// Min and Max bound numbers; for strings they bound the length.
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Values []string `json:"values,omitempty"`
+	// Pattern, when set, must match the whole string value.
+	Pattern     string `json:"pattern,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description"`
+	// Restart is set for cvars that only take effect when the server starts.
+	Restart bool `json:"restart"`
+	// Field names the ServerSettings field that manages this cvar; such
+	// cvars can't be set as extra cvars.
+	Field string `json:"field,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// FieldError is a validation error of one settings field or cvar.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Errors collects the field errors of one validation.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Schema is a registry of known cvars.
+type Schema struct {
+	cvars []Cvar
+	index map[string]int
+	// extraPrefixes are the name prefixes unknown extra cvars must have.
+	extraPrefixes []string
+}
+
+// DefaultExtraPrefixes cover the game's own cvar namespaces. Plugin cvars
+// need their prefix added with SetExtraPrefixes.
+var DefaultExtraPrefixes = []string{"mp_", "sv_", "bot_", "tv_", "ammo_", "cash_", "ff_", "spec_", "weapon_"}
+
+// commands are console commands that share a prefix with cvars, or that
+// "*" in the prefixes would let through. Writing them into a config runs
+// them, so they are never accepted as extra cvars.
+var commands = map[string]bool{
+	"quit": true, "exit": true, "exec": true, "execifexists": true, "alias": true, "bind": true,
+	"changelevel": true, "map": true, "ds_workshop_changelevel": true, "host_workshop_map": true,
+	"host_workshop_collection": true, "restart": true, "reload": true, "disconnect": true,
+	"kick": true, "kickid": true, "kickall": true, "banid": true, "banip": true, "addip": true,
+	"removeid": true, "removeip": true, "writeid": true, "writeip": true, "rcon": true, "say": true,
+	"say_team": true, "status": true, "echo": true, "log": true, "logaddress_add": true,
+	"sv_shutdown": true, "sv_cancel_shutdown": true, "sv_dump_entity_list": true,
+	"mp_restartgame": true, "mp_warmup_start": true, "mp_warmup_end": true, "mp_swapteams": true,
+	"mp_scrambleteams": true, "mp_switchteams": true, "mp_pause_match": true, "mp_unpause_match": true,
+	"mp_endmatch": true, "mp_backup_restore_load_file": true, "mp_backup_restore_list_files": true,
+	"bot_add": true, "bot_add_ct": true, "bot_add_t": true, "bot_kick": true, "bot_kill": true,
+	"bot_place": true, "bot_goto_mark": true, "tv_record": true, "tv_stoprecord": true, "tv_stop": true,
+	"tv_broadcast": true,
+}
+
+func NewSchema(cvars []Cvar) (*Schema, error) {
+	s := &Schema{index: make(map[string]int, len(cvars)), extraPrefixes: DefaultExtraPrefixes}
+	for _, c := range cvars {
+		if _, dup := s.index[c.Name]; dup {
+			return nil, fmt.Errorf("duplicate cvar %s", c.Name)
+		}
+		if c.Pattern != "" {
+			re, err := regexp.Compile(`^(?:` + c.Pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("cvar %s: %w", c.Name, err)
+			}
+			c.pattern = re
+		}
+		s.index[c.Name] = len(s.cvars)
+		s.cvars = append(s.cvars, c)
+	}
+	return s, nil
+}
+
+// All returns the cvars in the order they were registered.
+func (s *Schema) All() []Cvar {
+	return slices.Clone(s.cvars)
+}
+
+func (s *Schema) Lookup(name string) (Cvar, bool) {
+	i, ok := s.index[strings.ToLower(name)]
+	if !ok {
+		return Cvar{}, false
+	}
+	return s.cvars[i], true
+}
+
+// Validate checks value against the cvar and returns it in canonical form:
+// booleans become 0 or 1 and numbers lose redundant formatting.
+func (c Cvar) Validate(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch c.Type {
+	case Bool:
+		switch strings.ToLower(value) {
+		case "1", "true", "yes", "on":
+			return "1", nil
+		case "0", "false", "no", "off":
+			return "0", nil
+		}
+		return "", errors.New("must be a boolean")
+	case Int:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", errors.New("must be an integer")
+		}
+		if err := c.checkRange(float64(n)); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case Float:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", errors.New("must be a number")
+		}
+		if err := c.checkRange(f); err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case Enum:
+		if !slices.Contains(c.Values, value) {
+			return "", fmt.Errorf("must be one of %s", strings.Join(c.Values, ", "))
+		}
+		return value, nil
+	default:
+		if err := checkString(value); err != nil {
+			return "", err
+		}
+		if c.Min != nil && float64(len(value)) < *c.Min {
+			return "", fmt.Errorf("must be at least %g characters", *c.Min)
+		}
+		if c.Max != nil && float64(len(value)) > *c.Max {
+			return "", fmt.Errorf("must be at most %g characters", *c.Max)
+		}
+		if c.pattern != nil && !c.pattern.MatchString(value) {
+			return "", errors.New("has an invalid format")
+		}
+		return value, nil
+	}
+}
+
+func (c Cvar) checkRange(f float64) error {
+	switch {
+	case c.Min != nil && c.Max != nil && (f < *c.Min || f > *c.Max):
+		return fmt.Errorf("must be between %g and %g", *c.Min, *c.Max)
+	case c.Min != nil && f < *c.Min:
+		return fmt.Errorf("must be at least %g", *c.Min)
+	case c.Max != nil && f > *c.Max:
+		return fmt.Errorf("must be at most %g", *c.Max)
+	}
+	return nil
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SetExtraPrefixes replaces the name prefixes unknown extra cvars must have;
+// "*" allows any name. Call it before the schema is in use.
+func (s *Schema) SetExtraPrefixes(prefixes []string) {
+	s.extraPrefixes = make([]string, len(prefixes))
+	for i, p := range prefixes {
+		s.extraPrefixes[i] = strings.ToLower(p)
+	}
+}
+
+// ExtraPrefixes returns the name prefixes unknown extra cvars must have.
+func (s *Schema) ExtraPrefixes() []string {
+	return slices.Clone(s.extraPrefixes)
+}
+
+// ValidateExtra checks a cvar set outside the settings fields. Known cvars
+// are validated against the schema. Unknown ones, such as plugin cvars, need
+// a well-formed name with one of the extra prefixes, must not be a console
+// command and need a value that can't break out of the config.
+func (s *Schema) ValidateExtra(name, value string) (string, string, error) {
+	if c, ok := s.Lookup(name); ok {
+		if c.Field != "" {
+			return "", "", fmt.Errorf("is set through the %s setting", c.Field)
+		}
+		v, err := c.Validate(value)
+		return c.Name, v, err
+	}
+	if !namePattern.MatchString(name) {
+		return "", "", errors.New("is not a valid cvar name")
+	}
+	name = strings.ToLower(name)
+	if commands[name] {
+		return "", "", errors.New("is a console command, not a cvar")
+	}
+	if !s.extraAllowed(name) {
+		return "", "", fmt.Errorf("must start with one of %s", strings.Join(s.extraPrefixes, ", "))
+	}
+	value = strings.TrimSpace(value)
+	if err := checkString(value); err != nil {
+		return "", "", err
+	}
+	return name, value, nil
+}
+
+func (s *Schema) extraAllowed(name string) bool {
+	for _, p := range s.extraPrefixes {
+		if p == "*" || strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateExtras validates a map of extra cvars, returning the canonical
+// map or one FieldError per bad entry, named cvars.<name>.
+func (s *Schema) ValidateExtras(extra map[string]string) (map[string]string, Errors) {
+	out := make(map[string]string, len(extra))
+	var errs Errors
+	for _, name := range sortedKeys(extra) {
+		canon, v, err := s.ValidateExtra(name, extra[name])
+		if err != nil {
+			errs = append(errs, FieldError{Field: "cvars." + name, Message: err.Error()})
+			continue
+		}
+		out[canon] = v
+	}
+	return out, errs
+}
+
+// checkString rejects what would end the quoted value in a config line.
+func checkString(v string) error {
+	if strings.ContainsAny(v, "\"\r\n") {
+		return errors.New("must not contain quotes or line breaks")
+	}
+	return nil
+}
+
+// Command returns the console line that sets name to value.
+func Command(name, value string) string {
+	return name + ` "` + value + `"`
+}
+
+// Render writes the cvars as a config file, one per line, sorted by name.
+func Render(header string, values map[string]string) []byte {
+	var b bytes.Buffer
+	for _, line := range strings.Split(header, "\n") {
+		b.WriteString("// " + line + "\n")
+	}
+	for _, name := range sortedKeys(values) {
+		b.WriteString(Command(name, values[name]) + "\n")
+	}
+	return b.Bytes()
+}
+
+// Parse reads the name "value" lines of a config file such as one written
+// by Render. Comments and other commands are skipped.
+func Parse(data []byte) map[string]string {
+	values := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		name, rest, ok := strings.Cut(line, " ")
+		if !ok || !namePattern.MatchString(name) {
+			continue
+		}
+		rest = strings.TrimSpace(rest)
+		if len(rest) >= 2 && rest[0] == '"' && rest[len(rest)-1] == '"' {
+			rest = rest[1 : len(rest)-1]
+		}
+		values[strings.ToLower(name)] = rest
+	}
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,164 @@
+package cvars
+
+// GameMode is a valid game_type and game_mode pair.
+type GameMode struct {
+	Name string `json:"name"`
+	Type string `json:"gameType"`
+	Mode string `json:"gameMode"`
+}
+
+var GameModes = []GameMode{
+	{Name: "casual", Type: "0", Mode: "0"},
+	{Name: "competitive", Type: "0", Mode: "1"},
+	{Name: "wingman", Type: "0", Mode: "2"},
+	{Name: "armsrace", Type: "1", Mode: "0"},
+	{Name: "demolition", Type: "1", Mode: "1"},
+	{Name: "deathmatch", Type: "1", Mode: "2"},
+	{Name: "training", Type: "2", Mode: "0"},
+	{Name: "custom", Type: "3", Mode: "0"},
+}
+
+// LookupGameMode returns the game mode with the given type and mode.
+func LookupGameMode(gameType, gameMode string) (GameMode, bool) {
+	for _, m := range GameModes {
+		if m.Type == gameType && m.Mode == gameMode {
+			return m, true
+		}
+	}
+	return GameMode{}, false
+}
+
+func num(f float64) *float64 {
+	return &f
+}
+
+// Default is the schema of the CS2 cvars the panel knows about.
+var Default = mustSchema([]Cvar{
+	// Managed through ServerSettings.
+	{Name: "hostname", Type: String, Max: num(64), Default: "CS2 Server", Field: "serverName",
+		Description: "Server name shown in the server browser"},
+	{Name: "maxplayers", Type: Int, Min: num(1), Max: num(64), Default: "10", Restart: true, Field: "maxPlayers",
+		Description: "Player slots; read when the server starts"},
+	{Name: "tickrate", Type: Enum, Values: []string{"64", "128"}, Default: "128", Restart: true, Field: "tickrate",
+		Description: "Server tick rate; set with -tickrate when the server starts"},
+	{Name: "rcon_password", Type: String, Min: num(1), Max: num(64), Field: "rconPassword",
+		Description: "Password for remote console access"},
+	{Name: "sv_password", Type: String, Max: num(64), Field: "svPassword",
+		Description: "Password players need to join; empty for a public server"},
+	{Name: "game_type", Type: Enum, Values: []string{"0", "1", "2", "3"}, Default: "0", Field: "gameType",
+		Description: "Game type: 0 classic, 1 gungame, 2 training, 3 custom; applies from the next map"},
+	{Name: "game_mode", Type: Enum, Values: []string{"0", "1", "2"}, Default: "1", Field: "gameMode",
+		Description: "Game mode within the game type, e.g. 0/1 competitive, 0/2 wingman, 1/2 deathmatch; applies from the next map"},
+	{Name: "map", Type: String, Max: num(128), Pattern: `[A-Za-z0-9_\-]+(/[A-Za-z0-9_\-]+)*`, Default: "de_dust2", Field: "map",
+		Description: "Map to load, e.g. de_mirage or workshop/<id>/<name>"},
+	{Name: "mapgroup", Type: String, Max: num(64), Pattern: `[A-Za-z0-9_]+`, Default: "mg_active", Restart: true, Field: "mapGroup",
+		Description: "Map group the server rotates through; set with +mapgroup when the server starts"},
+
+	// Match rules.
+	{Name: "mp_maxrounds", Type: Int, Min: num(0), Max: num(99), Default: "24",
+		Description: "Maximum rounds per match"},
+	{Name: "mp_roundtime", Type: Float, Min: num(1), Max: num(60), Default: "1.92",
+		Description: "Round length in minutes"},
+	{Name: "mp_roundtime_defuse", Type: Float, Min: num(0), Max: num(60), Default: "1.92",
+		Description: "Round length in minutes on bomb defusal maps"},
+	{Name: "mp_freezetime", Type: Int, Min: num(0), Max: num(60), Default: "15",
+		Description: "Freeze time at round start in seconds"},
+	{Name: "mp_buytime", Type: Int, Min: num(0), Max: num(3600), Default: "20",
+		Description: "Seconds after round start during which players can buy"},
+	{Name: "mp_buy_anywhere", Type: Bool, Default: "0",
+		Description: "Allow buying outside buy zones"},
+	{Name: "mp_startmoney", Type: Int, Min: num(0), Max: num(65535), Default: "800",
+		Description: "Money each player starts with"},
+	{Name: "mp_maxmoney", Type: Int, Min: num(0), Max: num(65535), Default: "16000",
+		Description: "Maximum money a player can hold"},
+	{Name: "mp_c4timer", Type: Int, Min: num(10), Max: num(90), Default: "40",
+		Description: "Seconds until the planted bomb explodes"},
+	{Name: "mp_timelimit", Type: Int, Min: num(0), Max: num(1440), Default: "0",
+		Description: "Map time limit in minutes; 0 for none"},
+	{Name: "mp_warmuptime", Type: Int, Min: num(0), Max: num(3600), Default: "60",
+		Description: "Warmup length in seconds"},
+	{Name: "mp_warmup_pausetimer", Type: Bool, Default: "0",
+		Description: "Keep warmup running until it is ended manually"},
+	{Name: "mp_halftime", Type: Bool, Default: "1",
+		Description: "Switch sides at halftime"},
+	{Name: "mp_overtime_enable", Type: Bool, Default: "0",
+		Description: "Play overtime when the match is tied"},
+	{Name: "mp_overtime_maxrounds", Type: Int, Min: num(1), Max: num(30), Default: "6",
+		Description: "Rounds per overtime"},
+	{Name: "mp_match_can_clinch", Type: Bool, Default: "1",
+		Description: "End the match once a team can't be caught"},
+	{Name: "mp_friendlyfire", Type: Bool, Default: "1",
+		Description: "Allow damage to teammates"},
+	{Name: "mp_autoteambalance", Type: Bool, Default: "1",
+		Description: "Balance teams automatically"},
+	{Name: "mp_limitteams", Type: Int, Min: num(0), Max: num(30), Default: "2",
+		Description: "Maximum difference in team sizes; 0 for no limit"},
+	{Name: "mp_autokick", Type: Bool, Default: "1",
+		Description: "Kick idle players and team killers"},
+	{Name: "mp_death_drop_gun", Type: Bool, Default: "1",
+		Description: "Drop the best weapon on death"},
+	{Name: "mp_respawn_on_death_ct", Type: Bool, Default: "0",
+		Description: "Respawn counter-terrorists after death"},
+	{Name: "mp_respawn_on_death_t", Type: Bool, Default: "0",
+		Description: "Respawn terrorists after death"},
+	{Name: "mp_teamname_1", Type: String, Max: num(32),
+		Description: "Name of the counter-terrorist team"},
+	{Name: "mp_teamname_2", Type: String, Max: num(32),
+		Description: "Name of the terrorist team"},
+	{Name: "ammo_grenade_limit_total", Type: Int, Min: num(0), Max: num(10), Default: "4",
+		Description: "Grenades a player can carry"},
+
+	// Server behaviour.
+	{Name: "sv_cheats", Type: Bool, Default: "0",
+		Description: "Allow cheat commands"},
+	{Name: "sv_alltalk", Type: Bool, Default: "0",
+		Description: "Let both teams hear each other"},
+	{Name: "sv_deadtalk", Type: Bool, Default: "0",
+		Description: "Let dead players talk to the living"},
+	{Name: "sv_full_alltalk", Type: Bool, Default: "0",
+		Description: "Let everyone, including spectators, hear each other"},
+	{Name: "sv_infinite_ammo", Type: Enum, Values: []string{"0", "1", "2"}, Default: "0",
+		Description: "1 for infinite ammo without reloading, 2 for infinite reserve ammo"},
+	{Name: "sv_gravity", Type: Float, Min: num(0), Max: num(2000), Default: "800",
+		Description: "World gravity"},
+	{Name: "sv_hibernate_when_empty", Type: Bool, Default: "1",
+		Description: "Hibernate while no players are connected"},
+	{Name: "sv_visiblemaxplayers", Type: Int, Min: num(-1), Max: num(64), Default: "-1",
+		Description: "Player limit shown in the server browser; -1 for maxplayers"},
+	{Name: "sv_lan", Type: Bool, Default: "0", Restart: true,
+		Description: "Only accept players from the local network"},
+	{Name: "sv_region", Type: Int, Min: num(-1), Max: num(255), Default: "-1",
+		Description: "Region reported to the master server"},
+	{Name: "sv_maxrate", Type: Int, Min: num(0), Max: num(1048576), Default: "0",
+		Description: "Maximum bandwidth per client in bytes per second; 0 for unlimited"},
+	{Name: "sv_minrate", Type: Int, Min: num(0), Max: num(1048576), Default: "98304",
+		Description: "Minimum bandwidth per client in bytes per second"},
+	{Name: "sv_grenade_trajectory_prac_pipreview", Type: Bool, Default: "0",
+		Description: "Show a grenade trajectory preview while aiming"},
+	{Name: "sv_showimpacts", Type: Enum, Values: []string{"0", "1", "2", "3"}, Default: "0",
+		Description: "Show bullet impacts: 1 client and server, 2 client, 3 server"},
+
+	// Bots.
+	{Name: "bot_quota", Type: Int, Min: num(0), Max: num(64), Default: "10",
+		Description: "Number of bots"},
+	{Name: "bot_quota_mode", Type: Enum, Values: []string{"normal", "fill", "match", "competitive"}, Default: "competitive",
+		Description: "How bot_quota is applied"},
+	{Name: "bot_difficulty", Type: Enum, Values: []string{"0", "1", "2", "3"}, Default: "2",
+		Description: "Bot difficulty: 0 easy to 3 expert"},
+
+	// SourceTV.
+	{Name: "tv_enable", Type: Bool, Default: "0", Restart: true,
+		Description: "Enable SourceTV"},
+	{Name: "tv_delay", Type: Int, Min: num(0), Max: num(600), Default: "10",
+		Description: "SourceTV broadcast delay in seconds"},
+	{Name: "tv_autorecord", Type: Bool, Default: "0",
+		Description: "Record demos of every match"},
+})
+
+func mustSchema(cvars []Cvar) *Schema {
+	s, err := NewSchema(cvars)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
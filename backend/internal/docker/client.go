@@ -3,6 +3,7 @@ package docker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -11,8 +12,13 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/go-connections/nat"
+
+	"github.com/chi2l3s/cloudstrike/internal/metrics"
 )
 
 type Client struct {
@@ -37,17 +43,49 @@ func (c *Client) Close() error {
 }
 
 func (c *Client) Ping() error {
+	start := time.Now()
 	_, err := c.cli.Ping(c.ctx)
+	metrics.ObserveDockerCall("ping", start, err)
 	return err
 }
 
 func (c *Client) ListContainers() ([]types.Container, error) {
-	return c.cli.ContainerList(c.ctx, container.ListOptions{All: true})
+	start := time.Now()
+	containers, err := c.cli.ContainerList(c.ctx, container.ListOptions{All: true})
+	metrics.ObserveDockerCall("container_list", start, err)
+	return containers, err
+}
+
+// GameServerSpec describes a CS2 server container to create.
+type GameServerSpec struct {
+	Name         string
+	Port         string
+	RconPassword string
+	Template     string
+	Tags         []string
+	// DataDir, when set, is backed by a named volume so the server's files
+	// stay reachable while it is stopped and survive container re-creation.
+	DataDir string
+	// Env holds further CS2_* variables of the image, such as the map and
+	// player limit.
+	Env map[string]string
+	// Resources are resource limits such as memory and CPUs; the zero value
+	// leaves the container unlimited.
+	Resources container.Resources
+}
+
+// DataVolume is the name of the volume holding a server's files.
+func DataVolume(name string) string {
+	return "cloudstrike-" + name + "-data"
 }
 
-func (c *Client) CreateGameServer(name string, port string, rconPassword string) (string, error) {
+func (c *Client) CreateGameServer(spec GameServerSpec) (string, error) {
+	name, port := spec.Name, spec.Port
+
 	// First try to pull the image (don't fail if already exists)
+	start := time.Now()
 	reader, err := c.cli.ImagePull(c.ctx, "joedwards32/cs2", image.PullOptions{})
+	metrics.ObserveDockerCall("image_pull", start, err)
 	if err == nil {
 		defer reader.Close()
 		io.Copy(io.Discard, reader)
@@ -69,33 +107,71 @@ func (c *Client) CreateGameServer(name string, port string, rconPassword string)
 	portTCP, _ := nat.NewPort("tcp", port)
 	portUDP, _ := nat.NewPort("udp", port)
 
+	labels := map[string]string{
+		"cloudstrike":      "true",
+		"cloudstrike.name": name,
+		"cloudstrike.port": port,
+	}
+	if spec.Template != "" {
+		labels["cloudstrike.template"] = spec.Template
+	}
+	if len(spec.Tags) > 0 {
+		labels["cloudstrike.tags"] = strings.Join(spec.Tags, ",")
+	}
+
+	var mounts []mount.Mount
+	if spec.DataDir != "" {
+		// Creating an existing volume is a no-op, so a server re-created
+		// under the same name keeps its files.
+		vol := DataVolume(name)
+		start = time.Now()
+		_, err := c.cli.VolumeCreate(c.ctx, volume.CreateOptions{
+			Name:   vol,
+			Labels: map[string]string{"cloudstrike": "true", "cloudstrike.name": name},
+		})
+		metrics.ObserveDockerCall("volume_create", start, err)
+		if err != nil {
+			return "", err
+		}
+		labels["cloudstrike.volume"] = vol
+		mounts = append(mounts, mount.Mount{Type: mount.TypeVolume, Source: vol, Target: spec.DataDir})
+	}
+
+	env := map[string]string{
+		"CS2_SERVERNAME": name,
+		"CS2_PORT":       port,
+		"CS2_RCON_PORT":  port,
+		"CS2_RCONPW":     spec.RconPassword,
+	}
+	for k, v := range spec.Env {
+		env[k] = v
+	}
+
+	start = time.Now()
 	resp, err := c.cli.ContainerCreate(c.ctx,
 		&container.Config{
-			Image: "joedwards32/cs2",
-			Env: []string{
-				"CS2_SERVERNAME=" + name,
-				"CS2_PORT=" + port,
-				"CS2_RCON_PORT=" + port,
-				"CS2_RCONPW=" + rconPassword,
-			},
-			Labels: map[string]string{
-				"cloudstrike":      "true",
-				"cloudstrike.name": name,
-				"cloudstrike.port": port,
-			},
+			Image:  "joedwards32/cs2",
+			Env:    envList(env),
+			Labels: labels,
 			ExposedPorts: nat.PortSet{
 				portTCP: struct{}{},
 				portUDP: struct{}{},
 			},
+			// Keep stdin open with a TTY so the console can attach to srcds.
+			OpenStdin: true,
+			Tty:       true,
 		},
 		&container.HostConfig{
 			PortBindings: nat.PortMap{
 				portTCP: []nat.PortBinding{{HostPort: port}},
 				portUDP: []nat.PortBinding{{HostPort: port}},
 			},
+			Mounts:    mounts,
+			Resources: spec.Resources,
 		},
 		nil, nil, "cloudstrike-"+name,
 	)
+	metrics.ObserveDockerCall("container_create", start, err)
 	if err != nil {
 		return "", err
 	}
@@ -103,27 +179,79 @@ func (c *Client) CreateGameServer(name string, port string, rconPassword string)
 	return resp.ID, nil
 }
 
+// ServerTags returns the tags stored in a server container's labels.
+func ServerTags(labels map[string]string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(labels["cloudstrike.tags"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 func (c *Client) StartContainer(id string) error {
-	return c.cli.ContainerStart(c.ctx, id, container.StartOptions{})
+	start := time.Now()
+	err := c.cli.ContainerStart(c.ctx, id, container.StartOptions{})
+	metrics.ObserveDockerCall("container_start", start, err)
+	return err
 }
 
-func (c *Client) StopContainer(id string) error {
-	return c.cli.ContainerStop(c.ctx, id, container.StopOptions{})
+// StopContainer sends SIGTERM and kills the container if it is still running
+// after timeout. A zero timeout uses the container's configured default.
+func (c *Client) StopContainer(id string, timeout time.Duration) error {
+	options := container.StopOptions{}
+	if timeout > 0 {
+		seconds := int(timeout.Seconds())
+		options.Timeout = &seconds
+	}
+
+	start := time.Now()
+	err := c.cli.ContainerStop(c.ctx, id, options)
+	metrics.ObserveDockerCall("container_stop", start, err)
+	return err
 }
 
 func (c *Client) RemoveContainer(id string) error {
-	return c.cli.ContainerRemove(c.ctx, id, container.RemoveOptions{Force: true})
+	start := time.Now()
+	err := c.cli.ContainerRemove(c.ctx, id, container.RemoveOptions{Force: true})
+	metrics.ObserveDockerCall("container_remove", start, err)
+	return err
+}
+
+func (c *Client) RemoveVolume(name string) error {
+	start := time.Now()
+	err := c.cli.VolumeRemove(c.ctx, name, false)
+	metrics.ObserveDockerCall("volume_remove", start, err)
+	return err
+}
+
+// VolumeExists reports whether a volume of that name exists.
+func (c *Client) VolumeExists(name string) (bool, error) {
+	start := time.Now()
+	_, err := c.cli.VolumeInspect(c.ctx, name)
+	if errdefs.IsNotFound(err) {
+		metrics.ObserveDockerCall("volume_inspect", start, nil)
+		return false, nil
+	}
+	metrics.ObserveDockerCall("volume_inspect", start, err)
+	return err == nil, err
 }
 
 type ContainerStats struct {
-	CPU         float64 `json:"cpu"`
-	Memory      uint64  `json:"memory"`
-	MemoryLimit uint64  `json:"memoryLimit"`
-	Uptime      int64   `json:"uptime"`
+	CPU          float64 `json:"cpu"`
+	Memory       uint64  `json:"memory"`
+	MemoryLimit  uint64  `json:"memoryLimit"`
+	NetworkRx    uint64  `json:"networkRx"`
+	NetworkTx    uint64  `json:"networkTx"`
+	Uptime       int64   `json:"uptime"`
+	RestartCount int     `json:"restartCount"`
 }
 
 func (c *Client) GetContainerStats(id string) (*ContainerStats, error) {
+	start := time.Now()
 	stats, err := c.cli.ContainerStatsOneShot(c.ctx, id)
+	metrics.ObserveDockerCall("container_stats", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -141,7 +269,13 @@ func (c *Client) GetContainerStats(id string) (*ContainerStats, error) {
 		cpuPercent = (cpuDelta / systemDelta) * float64(len(statsJSON.CPUStats.CPUUsage.PercpuUsage)) * 100.0
 	}
 
-	inspect, err := c.cli.ContainerInspect(c.ctx, id)
+	var networkRx, networkTx uint64
+	for _, network := range statsJSON.Networks {
+		networkRx += network.RxBytes
+		networkTx += network.TxBytes
+	}
+
+	inspect, err := c.inspect(id)
 	if err != nil {
 		return nil, err
 	}
@@ -153,10 +287,13 @@ func (c *Client) GetContainerStats(id string) (*ContainerStats, error) {
 	}
 
 	return &ContainerStats{
-		CPU:         cpuPercent,
-		Memory:      statsJSON.MemoryStats.Usage,
-		MemoryLimit: statsJSON.MemoryStats.Limit,
-		Uptime:      uptime,
+		CPU:          cpuPercent,
+		Memory:       statsJSON.MemoryStats.Usage,
+		MemoryLimit:  statsJSON.MemoryStats.Limit,
+		NetworkRx:    networkRx,
+		NetworkTx:    networkTx,
+		Uptime:       uptime,
+		RestartCount: inspect.RestartCount,
 	}, nil
 }
 
@@ -166,15 +303,22 @@ func (c *Client) GetContainerByPrefix(prefix string) (string, error) {
 		return "", err
 	}
 	for _, cont := range containers {
-		if strings.HasPrefix(cont.ID, prefix) {
+		if MatchesServerID(cont.ID, cont.Labels, prefix) {
 			return cont.ID, nil
 		}
 	}
 	return "", nil
 }
 
-func (c *Client) GetContainerIP(id string) (string, error) {
+func (c *Client) inspect(id string) (types.ContainerJSON, error) {
+	start := time.Now()
 	inspect, err := c.cli.ContainerInspect(c.ctx, id)
+	metrics.ObserveDockerCall("container_inspect", start, err)
+	return inspect, err
+}
+
+func (c *Client) GetContainerIP(id string) (string, error) {
+	inspect, err := c.inspect(id)
 	if err != nil {
 		return "", err
 	}
@@ -195,7 +339,7 @@ func (c *Client) GetContainerIP(id string) (string, error) {
 }
 
 func (c *Client) GetContainerPort(id string, portNum string) (string, error) {
-	inspect, err := c.cli.ContainerInspect(c.ctx, id)
+	inspect, err := c.inspect(id)
 	if err != nil {
 		return "", err
 	}
@@ -209,39 +353,55 @@ func (c *Client) GetContainerPort(id string, portNum string) (string, error) {
 	return portNum, nil
 }
 
-func (c *Client) ExecInContainer(id string, cmd []string) (string, error) {
-	execConfig := container.ExecOptions{
-		Cmd:          cmd,
-		AttachStdout: true,
-		AttachStderr: true,
-	}
-
-	execID, err := c.cli.ContainerExecCreate(c.ctx, id, execConfig)
-	if err != nil {
-		return "", err
+var ErrPathNotFound = errors.New("no such file or directory")
+
+// StatPath describes a path in the container without following a final
+// symlink; LinkTarget holds the fully resolved target for symlinks. It works
+// on stopped containers too.
+func (c *Client) StatPath(id, path string) (container.PathStat, error) {
+	start := time.Now()
+	stat, err := c.cli.ContainerStatPath(c.ctx, id, path)
+	if errdefs.IsNotFound(err) {
+		metrics.ObserveDockerCall("container_stat_path", start, nil)
+		return stat, ErrPathNotFound
 	}
+	metrics.ObserveDockerCall("container_stat_path", start, err)
+	return stat, err
+}
 
-	resp, err := c.cli.ContainerExecAttach(c.ctx, execID.ID, container.ExecAttachOptions{})
+func (c *Client) ContainerLabels(id string) (map[string]string, error) {
+	inspect, err := c.inspect(id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Close()
+	return inspect.Config.Labels, nil
+}
 
-	output, err := io.ReadAll(resp.Reader)
+// ContainerResources returns the resource limits of a container.
+func (c *Client) ContainerResources(id string) (container.Resources, error) {
+	inspect, err := c.inspect(id)
 	if err != nil {
-		return "", err
+		return container.Resources{}, err
 	}
-
-	return string(output), nil
+	return inspect.HostConfig.Resources, nil
 }
 
 func (c *Client) CopyFromContainer(id, srcPath string) (io.ReadCloser, error) {
+	start := time.Now()
 	reader, _, err := c.cli.CopyFromContainer(c.ctx, id, srcPath)
+	if errdefs.IsNotFound(err) {
+		metrics.ObserveDockerCall("copy_from_container", start, nil)
+		return nil, ErrPathNotFound
+	}
+	metrics.ObserveDockerCall("copy_from_container", start, err)
 	return reader, err
 }
 
 func (c *Client) CopyToContainer(id, dstPath string, content io.Reader) error {
-	return c.cli.CopyToContainer(c.ctx, id, dstPath, content, container.CopyToContainerOptions{})
+	start := time.Now()
+	err := c.cli.CopyToContainer(c.ctx, id, dstPath, content, container.CopyToContainerOptions{})
+	metrics.ObserveDockerCall("copy_to_container", start, err)
+	return err
 }
 
 func (c *Client) GetContainerLogs(id string, tail string) (string, error) {
@@ -252,7 +412,9 @@ func (c *Client) GetContainerLogs(id string, tail string) (string, error) {
 		Timestamps: true,
 	}
 
+	start := time.Now()
 	reader, err := c.cli.ContainerLogs(c.ctx, id, options)
+	metrics.ObserveDockerCall("container_logs", start, err)
 	if err != nil {
 		return "", err
 	}
@@ -265,6 +427,15 @@ func (c *Client) GetContainerLogs(id string, tail string) (string, error) {
 		return "", err
 	}
 
+	// TTY containers stream raw output without headers
+	inspect, err := c.inspect(id)
+	if err != nil {
+		return "", err
+	}
+	if inspect.Config.Tty {
+		return string(output), nil
+	}
+
 	// Clean docker log output - remove stream headers
 	var cleanLogs strings.Builder
 	data := output
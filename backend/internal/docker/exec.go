@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/chi2l3s/cloudstrike/internal/metrics"
+)
+
+// DefaultExecOutputLimit caps each output stream when ExecOptions.MaxOutput is unset.
+const DefaultExecOutputLimit = 1 << 20
+
+type ExecOptions struct {
+	WorkingDir string
+	Env        []string
+	// MaxOutput caps stdout and stderr separately. Output past the cap is
+	// drained and dropped so the process never blocks on a full pipe.
+	MaxOutput int64
+}
+
+type ExecResult struct {
+	ExitCode  int    `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated"`
+}
+
+// ExecInContainer runs cmd inside a running container and waits for it to
+// finish or for ctx to expire. Docker has no way to kill an exec process,
+// so on timeout the command may keep running in the container.
+func (c *Client) ExecInContainer(ctx context.Context, id string, cmd []string, opts ExecOptions) (*ExecResult, error) {
+	execConfig := container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+		WorkingDir:   opts.WorkingDir,
+		Env:          opts.Env,
+	}
+
+	start := time.Now()
+	execID, err := c.cli.ContainerExecCreate(ctx, id, execConfig)
+	metrics.ObserveDockerCall("exec_create", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	start = time.Now()
+	resp, err := c.cli.ContainerExecAttach(ctx, execID.ID, container.ExecAttachOptions{})
+	metrics.ObserveDockerCall("exec_attach", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	limit := opts.MaxOutput
+	if limit <= 0 {
+		limit = DefaultExecOutputLimit
+	}
+	stdout := &cappedBuffer{limit: limit}
+	stderr := &cappedBuffer{limit: limit}
+
+	copied := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, resp.Reader)
+		copied <- err
+	}()
+
+	select {
+	case err := <-copied:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		resp.Close()
+		return nil, fmt.Errorf("exec %q: %w", cmd[0], ctx.Err())
+	}
+
+	exitCode, err := c.execExitCode(ctx, execID.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecResult{
+		ExitCode:  exitCode,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}, nil
+}
+
+// execExitCode waits for the exec process to be reaped after its streams
+// close and returns its exit code.
+func (c *Client) execExitCode(ctx context.Context, execID string) (int, error) {
+	for {
+		start := time.Now()
+		inspect, err := c.cli.ContainerExecInspect(ctx, execID)
+		metrics.ObserveDockerCall("exec_inspect", start, err)
+		if err != nil {
+			return 0, err
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.buf.Len()); room < int64(len(p)) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,167 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/chi2l3s/cloudstrike/internal/metrics"
+)
+
+// ContainerState is the part of a container's inspect output the file
+// manager needs to decide how to reach its files.
+type ContainerState struct {
+	Running bool
+	Labels  map[string]string
+	// Mounts lists the destinations of the container's volumes and binds.
+	Mounts []string
+}
+
+func (c *Client) State(id string) (ContainerState, error) {
+	inspect, err := c.inspect(id)
+	if err != nil {
+		return ContainerState{}, err
+	}
+	state := ContainerState{Labels: inspect.Config.Labels}
+	if inspect.State != nil {
+		state.Running = inspect.State.Running
+	}
+	for _, m := range inspect.Mounts {
+		state.Mounts = append(state.Mounts, m.Destination)
+	}
+	return state, nil
+}
+
+// ExecInHelper runs cmd in a short-lived container created from the same
+// image and user as id, with all of id's volumes mounted. It is how commands
+// reach the files of a stopped server; only paths on volumes are shared.
+func (c *Client) ExecInHelper(ctx context.Context, id string, cmd []string, opts ExecOptions) (*ExecResult, error) {
+	target, err := c.inspect(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.runHelper(ctx, id, target.Image, target.Config.User, &container.HostConfig{VolumesFrom: []string{id}}, cmd, opts)
+}
+
+// CopyVolume copies paths, relative to the root of volume src, into volume
+// dst, or the whole volume if paths is empty. Paths missing in src are
+// skipped. It runs in a helper container created from the image and user of
+// id, with dst mounted at dataDir as in a server container, so a new volume
+// is first filled from the image and gets the ownership it expects.
+func (c *Client) CopyVolume(ctx context.Context, id, src, dst, dataDir string, paths []string) error {
+	target, err := c.inspect(id)
+	if err != nil {
+		return err
+	}
+	const source = "/cloudstrike-source"
+	script := `cd "$SOURCE" || exit 1
+if [ $# -eq 0 ]; then exec cp -a . "$DEST"/; fi
+for p do
+	[ -e "$p" ] || [ -L "$p" ] || continue
+	cp -a --parents -- "$p" "$DEST"/ || exit 1
+done`
+	cmd := append([]string{"sh", "-c", script, "sh"}, paths...)
+	result, err := c.runHelper(ctx, id, target.Image, target.Config.User, &container.HostConfig{
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: src, Target: source, ReadOnly: true},
+			{Type: mount.TypeVolume, Source: dst, Target: dataDir},
+		},
+	}, cmd, ExecOptions{Env: []string{"SOURCE=" + source, "DEST=" + dataDir}})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("copying files failed with exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// runHelper runs cmd in a short-lived container without network and waits
+// for it to exit. owner is the container the helper works for.
+func (c *Client) runHelper(ctx context.Context, owner, image, user string, host *container.HostConfig, cmd []string, opts ExecOptions) (*ExecResult, error) {
+	host.NetworkMode = network.NetworkNone
+
+	start := time.Now()
+	created, err := c.cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:      image,
+			User:       user,
+			Entrypoint: cmd[:1],
+			Cmd:        cmd[1:],
+			WorkingDir: opts.WorkingDir,
+			Env:        opts.Env,
+			Labels:     map[string]string{"cloudstrike.helper": owner},
+		},
+		host,
+		nil, nil, "",
+	)
+	metrics.ObserveDockerCall("helper_create", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		start := time.Now()
+		err := c.cli.ContainerRemove(context.WithoutCancel(ctx), created.ID, container.RemoveOptions{Force: true})
+		metrics.ObserveDockerCall("helper_remove", start, err)
+	}()
+
+	start = time.Now()
+	resp, err := c.cli.ContainerAttach(ctx, created.ID, container.AttachOptions{
+		Stream: true,
+		Stdout: true,
+		Stderr: true,
+	})
+	metrics.ObserveDockerCall("helper_attach", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	start = time.Now()
+	err = c.cli.ContainerStart(ctx, created.ID, container.StartOptions{})
+	metrics.ObserveDockerCall("helper_start", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.MaxOutput
+	if limit <= 0 {
+		limit = DefaultExecOutputLimit
+	}
+	stdout := &cappedBuffer{limit: limit}
+	stderr := &cappedBuffer{limit: limit}
+
+	copied := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, resp.Reader)
+		copied <- err
+	}()
+
+	select {
+	case err := <-copied:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, fmt.Errorf("helper %q: %w", cmd[0], ctx.Err())
+	}
+
+	waitCh, errCh := c.cli.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case result := <-waitCh:
+		return &ExecResult{
+			ExitCode:  int(result.StatusCode),
+			Stdout:    stdout.String(),
+			Stderr:    stderr.String(),
+			Truncated: stdout.truncated || stderr.truncated,
+		}, nil
+	case err := <-errCh:
+		return nil, err
+	}
+}
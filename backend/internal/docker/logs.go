@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/chi2l3s/cloudstrike/internal/metrics"
+)
+
+// FollowLogs streams the container's output written after since until ctx
+// is cancelled or the container exits. Stdout and stderr are merged.
+func (c *Client) FollowLogs(ctx context.Context, id string, since time.Time) (io.ReadCloser, error) {
+	inspect, err := c.inspect(id)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	reader, err := c.cli.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Since:      strconv.FormatInt(since.Unix(), 10),
+	})
+	metrics.ObserveDockerCall("container_logs", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if inspect.Config.Tty {
+		return reader, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, reader)
+		pw.CloseWithError(err)
+	}()
+
+	return &demuxedLogs{PipeReader: pr, source: reader}, nil
+}
+
+type demuxedLogs struct {
+	*io.PipeReader
+	source io.ReadCloser
+}
+
+func (l *demuxedLogs) Close() error {
+	l.source.Close()
+	return l.PipeReader.Close()
+}
@@ -0,0 +1,114 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/metrics"
+)
+
+var ErrRunning = errors.New("container is running")
+
+// ServerID is the ID the panel shows for a server. It is the short ID of
+// the first container created for the server and survives re-creation.
+func ServerID(id string, labels map[string]string) string {
+	if sid := labels["cloudstrike.id"]; sid != "" {
+		return sid
+	}
+	return id[:12]
+}
+
+// MatchesServerID reports whether prefix selects the container, either by
+// its own ID or by the server ID it inherited.
+func MatchesServerID(id string, labels map[string]string, prefix string) bool {
+	if prefix == "" {
+		return false
+	}
+	return strings.HasPrefix(id, prefix) || strings.HasPrefix(labels["cloudstrike.id"], prefix)
+}
+
+// ContainerEnv returns the environment of a container as a map.
+func (c *Client) ContainerEnv(id string) (map[string]string, error) {
+	inspect, err := c.inspect(id)
+	if err != nil {
+		return nil, err
+	}
+	return envMap(inspect.Config.Env), nil
+}
+
+// RecreateGameServer replaces the stopped container id with one that has the
+// same image, labels, ports and volumes, and env overlaid on its
+// environment. The old container is only removed once the new one exists.
+// It returns the new container's ID; the container is not started.
+func (c *Client) RecreateGameServer(id string, env map[string]string) (string, error) {
+	inspect, err := c.inspect(id)
+	if err != nil {
+		return "", err
+	}
+	if inspect.State != nil && inspect.State.Running {
+		return "", ErrRunning
+	}
+
+	cfg := *inspect.Config
+	// The hostname defaults to the container ID; let the new one get its own.
+	cfg.Hostname = ""
+	merged := envMap(cfg.Env)
+	for k, v := range env {
+		merged[k] = v
+	}
+	cfg.Env = envList(merged)
+	cfg.Labels = make(map[string]string, len(inspect.Config.Labels)+1)
+	for k, v := range inspect.Config.Labels {
+		cfg.Labels[k] = v
+	}
+	cfg.Labels["cloudstrike.id"] = ServerID(inspect.ID, inspect.Config.Labels)
+
+	name := strings.TrimPrefix(inspect.Name, "/")
+	backup := name + "-replaced"
+
+	start := time.Now()
+	err = c.cli.ContainerRename(c.ctx, id, backup)
+	metrics.ObserveDockerCall("container_rename", start, err)
+	if err != nil {
+		return "", err
+	}
+
+	start = time.Now()
+	resp, err := c.cli.ContainerCreate(c.ctx, &cfg, inspect.HostConfig, nil, nil, name)
+	metrics.ObserveDockerCall("container_create", start, err)
+	if err != nil {
+		start = time.Now()
+		rerr := c.cli.ContainerRename(c.ctx, id, name)
+		metrics.ObserveDockerCall("container_rename", start, rerr)
+		if rerr != nil {
+			return "", fmt.Errorf("%w; restoring the old container name also failed: %v", err, rerr)
+		}
+		return "", err
+	}
+
+	if err := c.RemoveContainer(id); err != nil {
+		return resp.ID, fmt.Errorf("server re-created, but removing the old container failed: %w", err)
+	}
+	return resp.ID, nil
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		m[k] = v
+	}
+	return m
+}
+
+func envList(m map[string]string) []string {
+	env := make([]string, 0, len(m))
+	for k, v := range m {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
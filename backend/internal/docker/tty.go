@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/chi2l3s/cloudstrike/internal/metrics"
+)
+
+// TTYSession is an interactive exec process with a pseudo-terminal attached.
+// Conn carries raw stdin and the combined terminal output.
+type TTYSession struct {
+	ExecID string
+	Conn   types.HijackedResponse
+}
+
+func (s *TTYSession) Close() {
+	s.Conn.Close()
+}
+
+func (c *Client) ExecTTY(id string, cmd []string, cols, rows uint) (*TTYSession, error) {
+	execConfig := container.ExecOptions{
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          []string{"TERM=xterm-256color"},
+	}
+	if cols > 0 && rows > 0 {
+		execConfig.ConsoleSize = &[2]uint{rows, cols}
+	}
+
+	start := time.Now()
+	execID, err := c.cli.ContainerExecCreate(c.ctx, id, execConfig)
+	metrics.ObserveDockerCall("exec_create", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	start = time.Now()
+	resp, err := c.cli.ContainerExecAttach(c.ctx, execID.ID, container.ExecAttachOptions{
+		Tty:         true,
+		ConsoleSize: execConfig.ConsoleSize,
+	})
+	metrics.ObserveDockerCall("exec_attach", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TTYSession{ExecID: execID.ID, Conn: resp}, nil
+}
+
+func (c *Client) ResizeExec(execID string, cols, rows uint) error {
+	start := time.Now()
+	err := c.cli.ContainerExecResize(c.ctx, execID, container.ResizeOptions{Height: rows, Width: cols})
+	metrics.ObserveDockerCall("exec_resize", start, err)
+	return err
+}
+
+var (
+	ErrNotRunning = errors.New("container is not running")
+	ErrNoStdin    = errors.New("container was created without stdin; recreate it to use the console")
+)
+
+// ConsoleSession is attached to the streams of a container's main process.
+// When TTY is false the output is multiplexed and must be demuxed with stdcopy.
+type ConsoleSession struct {
+	Conn types.HijackedResponse
+	TTY  bool
+}
+
+func (s *ConsoleSession) Close() {
+	s.Conn.Close()
+}
+
+func (c *Client) AttachConsole(id string) (*ConsoleSession, error) {
+	inspect, err := c.inspect(id)
+	if err != nil {
+		return nil, err
+	}
+	if !inspect.Config.OpenStdin {
+		return nil, ErrNoStdin
+	}
+	if !inspect.State.Running {
+		return nil, ErrNotRunning
+	}
+
+	start := time.Now()
+	resp, err := c.cli.ContainerAttach(c.ctx, id, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	metrics.ObserveDockerCall("container_attach", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConsoleSession{Conn: resp, TTY: inspect.Config.Tty}, nil
+}
+
+func (c *Client) ResizeContainer(id string, cols, rows uint) error {
+	start := time.Now()
+	err := c.cli.ContainerResize(c.ctx, id, container.ResizeOptions{Height: rows, Width: cols})
+	metrics.ObserveDockerCall("container_resize", start, err)
+	return err
+}
@@ -0,0 +1,212 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+var ErrFormat = errors.New("format must be zip or tar.gz")
+
+// ArchiveWriter receives entries read from docker's tar stream.
+type ArchiveWriter interface {
+	Add(hdr *tar.Header, body io.Reader) error
+	Close() error
+}
+
+func NewArchiveWriter(format string, w io.Writer) (ArchiveWriter, error) {
+	switch format {
+	case FormatZip:
+		return &zipWriter{zw: zip.NewWriter(w)}, nil
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	default:
+		return nil, ErrFormat
+	}
+}
+
+// ArchiveExt returns the file extension for format.
+func ArchiveExt(format string) string {
+	return "." + format
+}
+
+// ArchiveContentType returns the MIME type for format.
+func ArchiveContentType(format string) string {
+	if format == FormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// WriteArchive streams the given resolved paths into aw. Each path appears
+// under its path relative to the directory holding all of them, so files of
+// the same name in different directories don't collide.
+func (s *Sandbox) WriteArchive(fullID string, paths []string, aw ArchiveWriter) error {
+	for _, root := range archiveRoots(paths) {
+		if err := s.addToArchive(fullID, root, aw); err != nil {
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+// archiveRoot is a path to archive and the directory its entries go in.
+type archiveRoot struct {
+	path   string
+	prefix string
+}
+
+// archiveRoots places paths relative to the deepest directory holding all of
+// them. Duplicates and paths inside another of paths are dropped, as they
+// are archived with it.
+func archiveRoots(paths []string) []archiveRoot {
+	var kept []string
+	for _, p := range paths {
+		inside := slices.ContainsFunc(paths, func(q string) bool {
+			return p != q && strings.HasPrefix(p, strings.TrimSuffix(q, "/")+"/")
+		})
+		if !inside && !slices.Contains(kept, p) {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+
+	parent := path.Dir(kept[0])
+	for _, p := range kept[1:] {
+		dir := path.Dir(p)
+		for parent != "/" && dir != parent && !strings.HasPrefix(dir, parent+"/") {
+			parent = path.Dir(parent)
+		}
+	}
+
+	roots := make([]archiveRoot, 0, len(kept))
+	for _, p := range kept {
+		// Docker names the entries after the base name of p.
+		prefix := strings.TrimPrefix(strings.TrimPrefix(path.Dir(p), parent), "/")
+		roots = append(roots, archiveRoot{path: p, prefix: prefix})
+	}
+	return roots
+}
+
+func (s *Sandbox) addToArchive(fullID string, root archiveRoot, aw ArchiveWriter) error {
+	reader, err := s.docker.CopyFromContainer(fullID, root.path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if root.prefix != "" {
+			hdr.Name = path.Join(root.prefix, hdr.Name)
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Name += "/"
+			}
+			if hdr.Typeflag == tar.TypeLink {
+				hdr.Linkname = path.Join(root.prefix, hdr.Linkname)
+			}
+		}
+		if err := aw.Add(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) Add(hdr *tar.Header, body io.Reader) error {
+	info := hdr.FileInfo()
+	fh, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	fh.Name = strings.TrimPrefix(hdr.Name, "/")
+	fh.Modified = hdr.ModTime
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if !strings.HasSuffix(fh.Name, "/") {
+			fh.Name += "/"
+		}
+		_, err = z.zw.CreateHeader(fh)
+		return err
+	case tar.TypeSymlink:
+		// Zip stores the link target as the entry's content.
+		fh.Method = zip.Store
+		fw, err := z.zw.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(fw, hdr.Linkname)
+		return err
+	case tar.TypeReg:
+		fh.Method = zip.Deflate
+		fw, err := z.zw.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, body)
+		return err
+	default:
+		// Hard links, devices and fifos have no useful zip representation.
+		return nil
+	}
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarGzWriter) Add(hdr *tar.Header, body io.Reader) error {
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		_, err := io.Copy(t.tw, body)
+		return err
+	}
+	return nil
+}
+
+func (t *tarGzWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+// IsDir reports whether the resolved path p is a directory.
+func (s *Sandbox) IsDir(fullID, p string) (bool, error) {
+	stat, err := s.docker.StatPath(fullID, p)
+	if err != nil {
+		return false, err
+	}
+	return stat.Mode.IsDir(), nil
+}
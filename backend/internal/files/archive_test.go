@@ -0,0 +1,50 @@
+package files
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArchiveRoots(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []archiveRoot
+	}{
+		{"none", nil, nil},
+		{"one", []string{"/srv/game/cfg"}, []archiveRoot{{"/srv/game/cfg", ""}}},
+		{
+			"siblings",
+			[]string{"/srv/game/cfg", "/srv/game/addons"},
+			[]archiveRoot{{"/srv/game/cfg", ""}, {"/srv/game/addons", ""}},
+		},
+		{
+			"same base name",
+			[]string{"/srv/game/csgo/cfg/server.cfg", "/srv/game/core/cfg/server.cfg"},
+			[]archiveRoot{{"/srv/game/csgo/cfg/server.cfg", "csgo/cfg"}, {"/srv/game/core/cfg/server.cfg", "core/cfg"}},
+		},
+		{
+			"different depths",
+			[]string{"/srv/game/a.txt", "/srv/game/csgo/cfg/a.txt"},
+			[]archiveRoot{{"/srv/game/a.txt", ""}, {"/srv/game/csgo/cfg/a.txt", "csgo/cfg"}},
+		},
+		{
+			"inside another path",
+			[]string{"/srv/game/cfg/server.cfg", "/srv/game/cfg", "/srv/game/cfg"},
+			[]archiveRoot{{"/srv/game/cfg", ""}},
+		},
+		{
+			"similar names",
+			[]string{"/srv/game/cfg", "/srv/game/cfg2/x"},
+			[]archiveRoot{{"/srv/game/cfg", ""}, {"/srv/game/cfg2/x", "cfg2"}},
+		},
+		{"at the root", []string{"/a/b", "/c"}, []archiveRoot{{"/a/b", "a"}, {"/c", ""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := archiveRoots(tt.paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("archiveRoots(%q) = %v, want %v", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package files
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+var (
+	ErrNotRegular = errors.New("path is not a regular file")
+	ErrTooLarge   = errors.New("file is too large")
+	ErrBinary     = errors.New("file is not a text file")
+	ErrEncoding   = errors.New("unsupported encoding")
+)
+
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF8BOM = "utf-8-bom"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// File is a regular file read whole from a container.
+type File struct {
+	Path    string
+	Data    []byte
+	Mode    int64
+	Uid     int
+	Gid     int
+	ModTime time.Time
+}
+
+// ETag is a strong validator of the file contents.
+func (f *File) ETag() string {
+	return ETag(f.Data)
+}
+
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// ReadFile reads the regular file at p, which must already be resolved,
+// refusing files larger than limit bytes.
+func (s *Sandbox) ReadFile(fullID, p string, limit int64) (*File, error) {
+	reader, err := s.docker.CopyFromContainer(fullID, p)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, ErrNotRegular
+	}
+	if hdr.Size > limit {
+		return nil, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Path:    p,
+		Data:    data,
+		Mode:    hdr.Mode,
+		Uid:     hdr.Uid,
+		Gid:     hdr.Gid,
+		ModTime: hdr.ModTime,
+	}, nil
+}
+
+// WriteFile atomically replaces the file at p, which must already be
+// resolved: the data is copied next to it under a temporary name and then
+// renamed over it, so readers never see a partial file. mode, uid and gid
+// are applied to the new file.
+func (s *Sandbox) WriteFile(ctx context.Context, fullID, p string, data []byte, mode int64, uid, gid int) error {
+	return s.WriteFileFrom(ctx, fullID, p, bytes.NewReader(data), int64(len(data)), mode, uid, gid)
+}
+
+// WriteFileFrom is WriteFile for size bytes streamed from r.
+func (s *Sandbox) WriteFileFrom(ctx context.Context, fullID, p string, r io.Reader, size, mode int64, uid, gid int) error {
+	dir, name := path.Split(p)
+	tmpName := "." + name + ".cloudstrike-" + randomSuffix()
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		hdr := &tar.Header{
+			Name:    tmpName,
+			Mode:    mode,
+			Size:    size,
+			Uid:     uid,
+			Gid:     gid,
+			ModTime: time.Now(),
+		}
+		err := tw.WriteHeader(hdr)
+		if err == nil {
+			_, err = io.CopyN(tw, r, size)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err := s.docker.CopyToContainer(fullID, dir, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	tmp := path.Join(dir, tmpName)
+	if err := s.run(ctx, fullID, "mv", "-f", "--", tmp, p); err != nil {
+		s.run(context.WithoutCancel(ctx), fullID, "rm", "-f", "--", tmp)
+		return err
+	}
+	return nil
+}
+
+// Owner returns the numeric owner and group of p.
+func (s *Sandbox) Owner(ctx context.Context, fullID, p string) (int, int, error) {
+	result, err := s.exec(ctx, fullID, []string{"stat", "-c", "%u:%g", p}, docker.ExecOptions{})
+	if err != nil {
+		return 0, 0, err
+	}
+	var uid, gid int
+	if _, err := fmt.Sscanf(strings.TrimSpace(result.Stdout), "%d:%d", &uid, &gid); err != nil {
+		return 0, 0, fmt.Errorf("stat %s: %s", p, strings.TrimSpace(result.Stderr))
+	}
+	return uid, gid, nil
+}
+
+// run executes a command in the container, turning a non-zero exit into an
+// error carrying its stderr.
+func (s *Sandbox) run(ctx context.Context, fullID string, cmd ...string) error {
+	result, err := s.exec(ctx, fullID, cmd, docker.ExecOptions{})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return execError(cmd[0], result)
+	}
+	return nil
+}
+
+func execError(name string, result *docker.ExecResult) error {
+	msg := strings.TrimSpace(result.Stderr)
+	if msg == "" {
+		msg = fmt.Sprintf("exit code %d", result.ExitCode)
+	}
+	return fmt.Errorf("%s: %s", name, msg)
+}
+
+// DecodeText detects the encoding of data from its byte order mark and
+// returns the contents as UTF-8. Data without a BOM must be valid UTF-8 and
+// free of NUL bytes, otherwise it is treated as binary.
+func DecodeText(data []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		data = data[len(bomUTF8):]
+		if !utf8.Valid(data) {
+			return "", "", ErrBinary
+		}
+		return string(data), EncodingUTF8BOM, nil
+	case bytes.HasPrefix(data, bomUTF16LE):
+		text, err := decodeUTF16(data[2:], binary.LittleEndian)
+		return text, EncodingUTF16LE, err
+	case bytes.HasPrefix(data, bomUTF16BE):
+		text, err := decodeUTF16(data[2:], binary.BigEndian)
+		return text, EncodingUTF16BE, err
+	}
+
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", "", ErrBinary
+	}
+	return string(data), EncodingUTF8, nil
+}
+
+// EncodeText converts UTF-8 text to encoding, adding its byte order mark.
+func EncodeText(text, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", EncodingUTF8:
+		return []byte(text), nil
+	case EncodingUTF8BOM:
+		return append(append([]byte{}, bomUTF8...), text...), nil
+	case EncodingUTF16LE:
+		return encodeUTF16(text, bomUTF16LE, binary.LittleEndian), nil
+	case EncodingUTF16BE:
+		return encodeUTF16(text, bomUTF16BE, binary.BigEndian), nil
+	default:
+		return nil, ErrEncoding
+	}
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) (string, error) {
+	if len(data)%2 != 0 {
+		return "", ErrBinary
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func encodeUTF16(text string, bom []byte, order binary.AppendByteOrder) []byte {
+	units := utf16.Encode([]rune(text))
+	out := make([]byte, len(bom), len(bom)+2*len(units))
+	copy(out, bom)
+	for _, u := range units {
+		out = order.AppendUint16(out, u)
+	}
+	return out
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,472 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+var (
+	ErrArchiveFormat = errors.New("archive must be .zip, .tar, .tar.gz, .tgz or .7z")
+	ErrUnsafeEntry   = errors.New("archive entry escapes the destination")
+	ErrOverwrite     = errors.New("overwrite must be one of overwrite, skip, error")
+)
+
+const (
+	FormatTar = "tar"
+	Format7z  = "7z"
+)
+
+// Overwrite policies for Extract.
+const (
+	OverwriteReplace = "overwrite"
+	OverwriteSkip    = "skip"
+	OverwriteError   = "error"
+)
+
+// Progress receives a percentage (0-100) and a status line.
+type Progress func(percent float64, message string)
+
+type ExtractResult struct {
+	Destination string `json:"destination"`
+	Extracted   int    `json:"extracted"`
+	// Skipped counts existing files kept under the skip policy.
+	Skipped int `json:"skipped"`
+	// Ignored counts symlinks and special files, which are never extracted.
+	Ignored int `json:"ignored"`
+}
+
+type CompressResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ArchiveFormat guesses the format of an archive from its name.
+func ArchiveFormat(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTarGz
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar
+	case strings.HasSuffix(name, ".7z"):
+		return Format7z
+	default:
+		return ""
+	}
+}
+
+type archiveEntry struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+	open    func() (io.ReadCloser, error)
+}
+
+// Extract unpacks the archive at archivePath into dest, both already
+// resolved. The archive is staged on the panel host because zip and 7z need
+// random access. Entries are validated before anything is written: names
+// must stay inside dest and outside read-only paths, and with the error
+// policy no existing file may be replaced. Once they are, writing, if not
+// nil, gets the paths of the files about to be written.
+func (s *Sandbox) Extract(ctx context.Context, fullID, archivePath, dest, overwrite string, progress Progress, writing func(paths []string)) (*ExtractResult, error) {
+	format := ArchiveFormat(archivePath)
+	if format == "" {
+		return nil, ErrArchiveFormat
+	}
+	switch overwrite {
+	case "":
+		overwrite = OverwriteReplace
+	case OverwriteReplace, OverwriteSkip, OverwriteError:
+	default:
+		return nil, ErrOverwrite
+	}
+
+	policy, err := s.Policy(fullID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress(0, "fetching "+path.Base(archivePath))
+	staged, size, err := s.Stage(fullID, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+
+	if err := s.run(ctx, fullID, "mkdir", "-p", "--", dest); err != nil {
+		return nil, err
+	}
+	uid, gid, err := s.Owner(ctx, fullID, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Existing directories are left alone; docker would otherwise reset
+	// their owner and mode from the headers we send.
+	dirs, err := s.findEntries(ctx, fullID, dest, "d")
+	if err != nil {
+		return nil, err
+	}
+	var existing map[string]bool
+	if overwrite != OverwriteReplace {
+		if existing, err = s.findEntries(ctx, fullID, dest, "!d"); err != nil {
+			return nil, err
+		}
+	}
+
+	// First pass: validate every entry before writing anything.
+	progress(10, "checking archive")
+	var targets []string
+	err = walkArchive(staged, size, format, func(e archiveEntry, _ float64) error {
+		name, err := entryName(e.name)
+		if err != nil || name == "" {
+			return err
+		}
+		if err := policy.Writable(path.Join(dest, name)); err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+		if overwrite == OverwriteError && e.mode.IsRegular() && existing[name] {
+			return fmt.Errorf("%s: %w", name, ErrExists)
+		}
+		if e.mode.IsRegular() && !(overwrite == OverwriteSkip && existing[name]) {
+			targets = append(targets, path.Join(dest, name))
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if writing != nil {
+		writing(targets)
+	}
+
+	result := &ExtractResult{Destination: dest}
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		// Docker creates missing parents as root, so every directory is sent
+		// explicitly before the first entry inside it.
+		mkdir := func(name string, mode fs.FileMode, modTime time.Time) error {
+			if dirs[name] {
+				return nil
+			}
+			dirs[name] = true
+			return tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     name + "/",
+				Mode:     permOr(mode, 0o755),
+				Uid:      uid,
+				Gid:      gid,
+				ModTime:  modTime,
+			})
+		}
+		mkdirAll := func(name string, modTime time.Time) error {
+			parts := strings.Split(name, "/")
+			for i := 1; i < len(parts); i++ {
+				if err := mkdir(strings.Join(parts[:i], "/"), 0, modTime); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		err := walkArchive(staged, size, format, func(e archiveEntry, done float64) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			name, _ := entryName(e.name)
+			switch {
+			case name == "":
+				return nil
+			case e.mode.IsDir():
+				if err := mkdirAll(name, e.modTime); err != nil {
+					return err
+				}
+				return mkdir(name, e.mode, e.modTime)
+			case !e.mode.IsRegular():
+				result.Ignored++
+				return nil
+			case overwrite == OverwriteSkip && existing[name]:
+				result.Skipped++
+				return nil
+			}
+
+			progress(20+80*done, "extracting "+name)
+			if err := mkdirAll(name, e.modTime); err != nil {
+				return err
+			}
+			if err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     name,
+				Mode:     permOr(e.mode, 0o644),
+				Size:     e.size,
+				Uid:      uid,
+				Gid:      gid,
+				ModTime:  e.modTime,
+			}); err != nil {
+				return err
+			}
+			body, err := e.open()
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+			if _, err := io.CopyN(tw, body, e.size); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			result.Extracted++
+			return nil
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err = s.docker.CopyToContainer(fullID, dest, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Compress packs the resolved paths into a new archive at archivePath. The
+// archive is built on the panel host and then written atomically.
+func (s *Sandbox) Compress(ctx context.Context, fullID string, paths []string, archivePath, format string, progress Progress) (*CompressResult, error) {
+	if format == "" {
+		format = ArchiveFormat(archivePath)
+	}
+
+	staged, err := os.CreateTemp("", "cloudstrike-compress-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+
+	aw, err := NewArchiveWriter(format, staged)
+	if err != nil {
+		return nil, err
+	}
+	roots := archiveRoots(paths)
+	for i, root := range roots {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress(90*float64(i)/float64(len(roots)), "adding "+path.Base(root.path))
+		if err := s.addToArchive(fullID, root, aw); err != nil {
+			return nil, fmt.Errorf("%s: %w", root.path, err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+
+	size, err := staged.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	progress(90, "writing "+path.Base(archivePath))
+	uid, gid, err := s.Owner(ctx, fullID, path.Dir(archivePath))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.WriteFileFrom(ctx, fullID, archivePath, staged, size, 0o644, uid, gid); err != nil {
+		return nil, err
+	}
+	return &CompressResult{Path: archivePath, Size: size}, nil
+}
+
+// Stage copies a regular file out of the container into a temporary file,
+// which the caller must close and remove.
+func (s *Sandbox) Stage(fullID, p string) (*os.File, int64, error) {
+	reader, err := s.docker.CopyFromContainer(fullID, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, 0, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, 0, ErrNotRegular
+	}
+
+	f, err := os.CreateTemp("", "cloudstrike-stage-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, hdr.Size, nil
+}
+
+// findEntries lists the entries below dir, relative to it: directories for
+// kind "d", everything else for "!d".
+func (s *Sandbox) findEntries(ctx context.Context, fullID, dir, kind string) (map[string]bool, error) {
+	cmd := []string{"find", dir, "-mindepth", "1", "-type", "d", "-print0"}
+	if kind == "!d" {
+		cmd = []string{"find", dir, "-mindepth", "1", "!", "-type", "d", "-print0"}
+	}
+	result, err := s.exec(ctx, fullID, cmd, docker.ExecOptions{MaxOutput: listOutputLimit})
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 || result.Truncated {
+		return nil, fmt.Errorf("cannot list %s: %s", dir, strings.TrimSpace(result.Stderr))
+	}
+
+	existing := make(map[string]bool)
+	for _, p := range strings.Split(result.Stdout, "\x00") {
+		if rel := strings.TrimPrefix(p, dir+"/"); rel != p {
+			existing[rel] = true
+		}
+	}
+	return existing, nil
+}
+
+// entryName cleans an archive entry name into a path relative to the
+// destination. It returns "" for the destination itself and ErrUnsafeEntry
+// for anything that would land outside of it.
+func entryName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%s: %w", name, ErrUnsafeEntry)
+	}
+	name = path.Clean(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("%s: %w", name, ErrUnsafeEntry)
+	}
+	if name == "." {
+		return "", nil
+	}
+	return name, nil
+}
+
+// permOr returns the permissions of mode with a 022 umask applied, or def
+// when the archive recorded none.
+func permOr(mode fs.FileMode, def int64) int64 {
+	if perm := int64(mode.Perm()); perm != 0 {
+		return perm &^ 0o022
+	}
+	return def
+}
+
+// walkArchive calls fn for every entry of the staged archive with the
+// fraction of the archive processed so far.
+func walkArchive(f *os.File, size int64, format string, fn func(e archiveEntry, done float64) error) error {
+	switch format {
+	case FormatZip:
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return err
+		}
+		for i, zf := range zr.File {
+			e := archiveEntry{
+				name:    zf.Name,
+				mode:    zf.Mode(),
+				size:    int64(zf.UncompressedSize64),
+				modTime: zf.Modified,
+				open:    zf.Open,
+			}
+			if err := fn(e, float64(i)/float64(len(zr.File))); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case Format7z:
+		zr, err := sevenzip.NewReader(f, size)
+		if err != nil {
+			return err
+		}
+		for i, zf := range zr.File {
+			e := archiveEntry{
+				name:    zf.Name,
+				mode:    zf.Mode(),
+				size:    int64(zf.UncompressedSize),
+				modTime: zf.Modified,
+				open:    zf.Open,
+			}
+			if err := fn(e, float64(i)/float64(len(zr.File))); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case FormatTar, FormatTarGz:
+		counter := &countingReader{r: io.NewSectionReader(f, 0, size)}
+		var r io.Reader = counter
+		if format == FormatTarGz {
+			gz, err := gzip.NewReader(counter)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			e := archiveEntry{
+				name:    hdr.Name,
+				mode:    hdr.FileInfo().Mode(),
+				size:    hdr.Size,
+				modTime: hdr.ModTime,
+				open:    func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+			}
+			if err := fn(e, float64(counter.n)/float64(max(size, 1))); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return ErrArchiveFormat
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,272 @@
+package files
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+var (
+	ErrNotDir         = errors.New("path is not a directory")
+	ErrTooManyEntries = errors.New("directory has too many entries to list")
+)
+
+// Entry describes one directory entry.
+type Entry struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Type       string    `json:"type"`
+	IsDir      bool      `json:"isDir"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	Owner      string    `json:"owner"`
+	Group      string    `json:"group"`
+	LinkTarget string    `json:"linkTarget,omitempty"`
+	MimeType   string    `json:"mimeType,omitempty"`
+	ModTime    time.Time `json:"modTime"`
+}
+
+const (
+	TypeFile    = "file"
+	TypeDir     = "dir"
+	TypeSymlink = "symlink"
+	TypeOther   = "other"
+)
+
+// listOutputLimit caps the find output; larger directories aren't listed.
+const listOutputLimit = 16 << 20
+
+// One record per entry, every field NUL-terminated: type, type of the link
+// target, octal mode, owner, group, size, mtime, link target, path relative
+// to the starting directory.
+const findFormat = `%y\0%Y\0%m\0%u\0%g\0%s\0%T@\0%l\0%P\0`
+
+const findFields = 9
+
+// List returns the entries of dir, which must already be resolved. It uses
+// find -printf when the image has GNU find and otherwise stats the entries
+// one by one. Only dir itself is read, never the tree below it.
+func (s *Sandbox) List(ctx context.Context, fullID, dir string) ([]Entry, error) {
+	stat, err := s.docker.StatPath(fullID, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.Mode.IsDir() {
+		return nil, ErrNotDir
+	}
+
+	result, err := s.exec(ctx, fullID,
+		[]string{"find", dir, "-mindepth", "1", "-maxdepth", "1", "-printf", findFormat},
+		docker.ExecOptions{MaxOutput: listOutputLimit})
+	if err != nil {
+		return nil, err
+	}
+	if result.Truncated {
+		return nil, ErrTooManyEntries
+	}
+	if result.ExitCode == 0 {
+		if entries, ok := parseFind(result.Stdout, dir); ok {
+			return entries, nil
+		}
+	}
+
+	return s.listByStat(ctx, fullID, dir)
+}
+
+func parseFind(output, dir string) ([]Entry, bool) {
+	fields := strings.Split(output, "\x00")
+	// A trailing NUL leaves one empty element after the last record.
+	fields = fields[:len(fields)-1]
+	if len(fields)%findFields != 0 {
+		return nil, false
+	}
+
+	entries := make([]Entry, 0, len(fields)/findFields)
+	for i := 0; i < len(fields); i += findFields {
+		f := fields[i : i+findFields]
+
+		perm, err := strconv.ParseUint(f[2], 8, 32)
+		if err != nil {
+			return nil, false
+		}
+		size, _ := strconv.ParseInt(f[5], 10, 64)
+		mtime, _ := strconv.ParseFloat(f[6], 64)
+
+		e := Entry{
+			Name:       path.Base(f[8]),
+			Path:       path.Join(dir, f[8]),
+			Type:       findType(f[0]),
+			IsDir:      f[0] == "d" || (f[0] == "l" && f[1] == "d"),
+			Size:       size,
+			Mode:       fmt.Sprintf("%04o", perm),
+			Owner:      f[3],
+			Group:      f[4],
+			LinkTarget: f[7],
+			ModTime:    time.Unix(0, int64(mtime*float64(time.Second))).UTC(),
+		}
+		e.MimeType = mimeType(e)
+		entries = append(entries, e)
+	}
+	return entries, true
+}
+
+func findType(t string) string {
+	switch t {
+	case "f":
+		return TypeFile
+	case "d":
+		return TypeDir
+	case "l":
+		return TypeSymlink
+	default:
+		return TypeOther
+	}
+}
+
+// listByStat lists the immediate children of dir by name and stats each
+// one through docker. It is the fallback for images without GNU find, whose
+// find can't -printf; owner and group stay empty as stat doesn't report
+// them.
+func (s *Sandbox) listByStat(ctx context.Context, fullID, dir string) ([]Entry, error) {
+	result, err := s.exec(ctx, fullID,
+		[]string{"find", dir, "-mindepth", "1", "-maxdepth", "1", "-print0"},
+		docker.ExecOptions{MaxOutput: listOutputLimit})
+	if err != nil {
+		return nil, err
+	}
+	if result.Truncated {
+		return nil, ErrTooManyEntries
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("cannot list %s: %s", dir, strings.TrimSpace(result.Stderr))
+	}
+
+	entries := []Entry{}
+	for _, p := range strings.Split(result.Stdout, "\x00") {
+		name, ok := strings.CutPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		stat, err := s.docker.StatPath(fullID, p)
+		if err != nil {
+			// The entry went away since find saw it.
+			continue
+		}
+
+		e := Entry{
+			Name:       name,
+			Path:       path.Join(dir, name),
+			Mode:       fmt.Sprintf("%04o", unixMode(stat.Mode)),
+			LinkTarget: stat.LinkTarget,
+			ModTime:    stat.Mtime.UTC(),
+		}
+		switch {
+		case stat.Mode.IsRegular():
+			e.Type = TypeFile
+			e.Size = stat.Size
+		case stat.Mode.IsDir():
+			e.Type = TypeDir
+			e.IsDir = true
+		case stat.Mode&fs.ModeSymlink != 0:
+			e.Type = TypeSymlink
+			target := stat.LinkTarget
+			if !path.IsAbs(target) {
+				target = path.Join(dir, target)
+			}
+			if t, err := s.docker.StatPath(fullID, target); err == nil {
+				e.IsDir = t.Mode.IsDir()
+			}
+		default:
+			e.Type = TypeOther
+		}
+		e.MimeType = mimeType(e)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// unixMode returns the permission bits of mode as stat prints them.
+func unixMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 0o1000
+	}
+	return m
+}
+
+// Game formats that the system MIME table usually does not know about.
+var textExtensions = map[string]bool{
+	".cfg": true, ".ini": true, ".vdf": true, ".txt": true, ".log": true,
+	".kv3": true, ".vmt": true, ".res": true, ".sh": true,
+}
+
+func mimeType(e Entry) string {
+	if e.IsDir || e.Type == TypeOther {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(e.Name))
+	if textExtensions[ext] {
+		return "text/plain; charset=utf-8"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// SortEntries orders entries by key (name, size, modTime or type), always
+// keeping directories first.
+func SortEntries(entries []Entry, key string, desc bool) error {
+	var compare func(a, b Entry) int
+	switch key {
+	case "", "name":
+		compare = func(a, b Entry) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) }
+	case "size":
+		compare = func(a, b Entry) int { return cmp.Compare(a.Size, b.Size) }
+	case "modTime":
+		compare = func(a, b Entry) int { return a.ModTime.Compare(b.ModTime) }
+	case "type":
+		compare = func(a, b Entry) int {
+			return strings.Compare(strings.ToLower(path.Ext(a.Name)), strings.ToLower(path.Ext(b.Name)))
+		}
+	default:
+		return errors.New("sort must be one of name, size, modTime, type")
+	}
+
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		c := compare(a, b)
+		if c == 0 {
+			c = strings.Compare(a.Name, b.Name)
+		}
+		if desc {
+			return -c
+		}
+		return c
+	})
+	return nil
+}
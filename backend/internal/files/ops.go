@@ -0,0 +1,81 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+var (
+	ErrExists  = errors.New("target already exists")
+	ErrBadMode = errors.New("mode must be an octal number up to 7777")
+)
+
+// The operations below take paths that were already resolved by Resolve.
+
+func (s *Sandbox) Remove(ctx context.Context, fullID, p string) error {
+	return s.run(ctx, fullID, "rm", "-rf", "--", p)
+}
+
+// Rmdir removes the directory p, which must be empty.
+func (s *Sandbox) Rmdir(ctx context.Context, fullID, p string) error {
+	return s.run(ctx, fullID, "rmdir", "--", p)
+}
+
+func (s *Sandbox) Mkdir(ctx context.Context, fullID, p string) error {
+	return s.run(ctx, fullID, "mkdir", "-p", "--", p)
+}
+
+// Move renames src to dst. An existing dst is only replaced when overwrite
+// is set, and never when it is a directory.
+func (s *Sandbox) Move(ctx context.Context, fullID, src, dst string, overwrite bool) error {
+	if err := s.CheckTarget(fullID, dst, overwrite); err != nil {
+		return err
+	}
+	return s.run(ctx, fullID, "mv", "-f", "--", src, dst)
+}
+
+// Copy copies src to dst recursively, preserving modes, owners and times.
+func (s *Sandbox) Copy(ctx context.Context, fullID, src, dst string, overwrite bool) error {
+	if err := s.CheckTarget(fullID, dst, overwrite); err != nil {
+		return err
+	}
+	return s.run(ctx, fullID, "cp", "-a", "--", src, dst)
+}
+
+func (s *Sandbox) Chmod(ctx context.Context, fullID, p string, mode uint32, recursive bool) error {
+	cmd := []string{"chmod"}
+	if recursive {
+		cmd = append(cmd, "-R")
+	}
+	cmd = append(cmd, fmt.Sprintf("%04o", mode), "--", p)
+	return s.run(ctx, fullID, cmd...)
+}
+
+// ParseMode parses an octal permission string such as "755" or "0644".
+func ParseMode(mode string) (uint32, error) {
+	n, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || n > 0o7777 {
+		return 0, ErrBadMode
+	}
+	return uint32(n), nil
+}
+
+// CheckTarget fails with ErrExists if dst exists, unless overwrite is set and
+// dst is not a directory.
+func (s *Sandbox) CheckTarget(fullID, dst string, overwrite bool) error {
+	stat, err := s.docker.StatPath(fullID, dst)
+	if errors.Is(err, docker.ErrPathNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !overwrite || stat.Mode.IsDir() {
+		return ErrExists
+	}
+	return nil
+}
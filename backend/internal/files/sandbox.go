@@ -0,0 +1,237 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+var (
+	ErrOutsideRoot = errors.New("path is outside the server directory")
+	ErrReadOnly    = errors.New("path is read-only")
+	ErrIsRoot      = errors.New("the server directory itself cannot be modified")
+	ErrBadLink     = errors.New("cannot resolve symbolic link")
+	ErrNoVolume    = errors.New("server is stopped and its files are not on a volume; start it or recreate the server")
+)
+
+// DefaultTemplate is used for servers created without a template label.
+const DefaultTemplate = "cs2"
+
+// Policy confines file access to Root. ReadOnly lists paths relative to Root
+// that may be read but never written, renamed or deleted.
+type Policy struct {
+	Root     string
+	ReadOnly []string
+}
+
+// Access is the kind of operation a path is resolved for.
+type Access int
+
+const (
+	Read Access = iota
+	// Write covers creating or replacing the entry at the path.
+	Write
+	// Modify covers deleting, renaming or moving the entry itself; symlinks
+	// are not followed in the final path element.
+	Modify
+)
+
+// Sandbox resolves user supplied paths against the policy of each server's
+// template, following symlinks inside the container.
+type Sandbox struct {
+	docker    *docker.Client
+	templates map[string]Policy
+	locks     [64]sync.Mutex
+}
+
+func NewSandbox(dockerClient *docker.Client, templates map[string]Policy) *Sandbox {
+	return &Sandbox{docker: dockerClient, templates: templates}
+}
+
+// Lock serializes read-modify-write sequences on one path of a server and
+// returns the unlock function.
+func (s *Sandbox) Lock(fullID, p string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(fullID + ":" + p))
+	mu := &s.locks[h.Sum32()%uint32(len(s.locks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (s *Sandbox) Policy(fullID string) (Policy, error) {
+	labels, err := s.docker.ContainerLabels(fullID)
+	if err != nil {
+		return Policy{}, err
+	}
+	return s.policyFor(labels), nil
+}
+
+func (s *Sandbox) policyFor(labels map[string]string) Policy {
+	template := labels["cloudstrike.template"]
+	if template == "" {
+		template = DefaultTemplate
+	}
+	policy, ok := s.templates[template]
+	if !ok {
+		policy = s.templates[DefaultTemplate]
+	}
+	return policy
+}
+
+// exec runs cmd in the server container while it is running. Stopped
+// servers are reached through a helper container that mounts their
+// volumes, which only works when the root is on a volume.
+func (s *Sandbox) exec(ctx context.Context, fullID string, cmd []string, opts docker.ExecOptions) (*docker.ExecResult, error) {
+	state, err := s.docker.State(fullID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Running {
+		return s.docker.ExecInContainer(ctx, fullID, cmd, opts)
+	}
+
+	root := path.Clean(s.policyFor(state.Labels).Root)
+	for _, mount := range state.Mounts {
+		if within(path.Clean(mount), root) {
+			return s.docker.ExecInHelper(ctx, fullID, cmd, opts)
+		}
+	}
+	return nil, ErrNoVolume
+}
+
+// Resolve turns p into a clean absolute path inside the server's root. p may
+// be absolute or relative to the root; an empty p is the root itself.
+func (s *Sandbox) Resolve(fullID, p string, access Access) (string, error) {
+	policy, err := s.Policy(fullID)
+	if err != nil {
+		return "", err
+	}
+	return s.resolve(fullID, policy, p, access)
+}
+
+func (s *Sandbox) resolve(fullID string, policy Policy, p string, access Access) (string, error) {
+	root := path.Clean(policy.Root)
+
+	if p == "" {
+		p = root
+	} else if !path.IsAbs(p) {
+		p = path.Join(root, p)
+	}
+	p = path.Clean(p)
+	if !within(root, p) {
+		return "", ErrOutsideRoot
+	}
+
+	resolved, err := s.followLinks(fullID, root, p, access != Modify)
+	if err != nil {
+		return "", err
+	}
+
+	if access != Read {
+		if resolved == root {
+			return "", ErrIsRoot
+		}
+		if policy.isReadOnly(resolved) {
+			return "", ErrReadOnly
+		}
+	}
+
+	return resolved, nil
+}
+
+// followLinks resolves symlinks in every element of p below root, checking
+// that each hop stays inside root. The final element is only followed when
+// followFinal is set.
+func (s *Sandbox) followLinks(fullID, root, p string, followFinal bool) (string, error) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+	if rel == "" {
+		return root, nil
+	}
+
+	current := root
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		next := path.Join(current, part)
+		last := i == len(parts)-1
+
+		if last && !followFinal {
+			current = next
+			break
+		}
+
+		target, err := s.readLink(fullID, next)
+		if errors.Is(err, docker.ErrPathNotFound) {
+			// Nothing below a missing element can be a link.
+			current = path.Join(append([]string{next}, parts[i+1:]...)...)
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if target != "" {
+			if !within(root, target) {
+				return "", ErrOutsideRoot
+			}
+			next = target
+		}
+		current = next
+	}
+
+	if !within(root, current) {
+		return "", ErrOutsideRoot
+	}
+	return current, nil
+}
+
+// readLink returns the resolved target of p, or "" if p is not a symlink.
+func (s *Sandbox) readLink(fullID, p string) (string, error) {
+	stat, err := s.docker.StatPath(fullID, p)
+	if err != nil {
+		return "", err
+	}
+	if stat.Mode&os.ModeSymlink == 0 {
+		return "", nil
+	}
+	if stat.LinkTarget == "" {
+		return "", ErrBadLink
+	}
+	return path.Clean(stat.LinkTarget), nil
+}
+
+// Writable checks a clean absolute path against the policy without touching
+// the container. It is meant for paths below a directory that was already
+// resolved, such as the entries of an archive being extracted.
+func (p Policy) Writable(abs string) error {
+	root := path.Clean(p.Root)
+	switch {
+	case !within(root, abs):
+		return ErrOutsideRoot
+	case abs == root:
+		return ErrIsRoot
+	case p.isReadOnly(abs):
+		return ErrReadOnly
+	}
+	return nil
+}
+
+func (p Policy) isReadOnly(abs string) bool {
+	root := path.Clean(p.Root)
+	for _, ro := range p.ReadOnly {
+		protected := path.Join(root, ro)
+		if within(protected, abs) || within(abs, protected) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether p is base or a descendant of base.
+func within(base, p string) bool {
+	return p == base || strings.HasPrefix(p, base+"/") || base == "/"
+}
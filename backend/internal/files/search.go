@@ -0,0 +1,301 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+var ErrPattern = errors.New("invalid search pattern")
+
+// Search output is capped like directory listings; a truncated candidate
+// list is reported rather than treated as an error.
+const searchOutputLimit = 16 << 20
+
+// timeoutExitCodes are the exit codes of a command stopped by timeout(1):
+// coreutils reports 124, busybox the 128+SIGTERM of the killed process.
+var timeoutExitCodes = []int{124, 143}
+
+// Matched lines longer than this are cut, so minified files don't blow up
+// the response.
+const maxLineLength = 512
+
+// SearchOptions selects what Search looks for. With an empty Query it finds
+// entries whose name matches the Name glob; otherwise it greps text files
+// (optionally restricted to Name) for Query.
+type SearchOptions struct {
+	Name       string
+	Query      string
+	Regex      bool
+	IgnoreCase bool
+	// Context is the number of lines returned around every match.
+	Context int
+	// Limit caps the number of entries in name mode and of matching lines
+	// in content mode.
+	Limit int
+	// MaxSize skips files larger than this many bytes.
+	MaxSize int64
+}
+
+type SearchMatch struct {
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+type SearchHit struct {
+	Path    string        `json:"path"`
+	Type    string        `json:"type"`
+	Size    int64         `json:"size"`
+	ModTime time.Time     `json:"modTime"`
+	Matches []SearchMatch `json:"matches,omitempty"`
+}
+
+// SearchResult is returned even when the search stopped early: Truncated
+// means not every match is listed, TimedOut that this is because the search
+// ran out of time.
+type SearchResult struct {
+	Results   []SearchHit `json:"results"`
+	Scanned   int         `json:"scanned"`
+	Truncated bool        `json:"truncated"`
+	TimedOut  bool        `json:"timedOut"`
+}
+
+// Search looks below dir, which must already be resolved. Candidates are
+// found with find inside the container, content candidates are prefiltered
+// with grep -I so binary files are never read, and matching lines are then
+// located in Go so that results look the same whatever grep the image has.
+func (s *Sandbox) Search(ctx context.Context, fullID, dir string, opts SearchOptions) (*SearchResult, error) {
+	stat, err := s.docker.StatPath(fullID, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.Mode.IsDir() {
+		return nil, ErrNotDir
+	}
+	if opts.Query == "" {
+		return s.searchNames(ctx, fullID, dir, opts)
+	}
+	return s.searchContent(ctx, fullID, dir, opts)
+}
+
+func (s *Sandbox) searchNames(ctx context.Context, fullID, dir string, opts SearchOptions) (*SearchResult, error) {
+	cmd := []string{"find", dir, "-mindepth", "1"}
+	cmd = append(cmd, nameTest(opts)...)
+	cmd = append(cmd, "-printf", findFormat)
+
+	result, err := s.exec(ctx, fullID, withTimeout(ctx, cmd, 1), docker.ExecOptions{MaxOutput: searchOutputLimit})
+	if err != nil {
+		return nil, err
+	}
+	output := completeRecords(result.Stdout, findFields)
+	timedOut := slices.Contains(timeoutExitCodes, result.ExitCode)
+	if output == "" && result.ExitCode != 0 && !timedOut {
+		return nil, execError(cmd[0], result)
+	}
+	entries, ok := parseFind(output, dir)
+	if !ok {
+		return nil, errors.New("find: unexpected output")
+	}
+
+	res := &SearchResult{
+		Results:   []SearchHit{},
+		Scanned:   len(entries),
+		Truncated: result.Truncated || timedOut,
+		TimedOut:  timedOut,
+	}
+	for _, e := range entries {
+		if len(res.Results) == opts.Limit {
+			res.Truncated = true
+			break
+		}
+		res.Results = append(res.Results, SearchHit{Path: e.Path, Type: e.Type, Size: e.Size, ModTime: e.ModTime})
+	}
+	return res, nil
+}
+
+func (s *Sandbox) searchContent(ctx context.Context, fullID, dir string, opts SearchOptions) (*SearchResult, error) {
+	match, err := lineMatcher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Literal queries are matched by grep already. Regular expressions are
+	// left to Go, since RE2 and the image's grep disagree on syntax, so grep
+	// with an empty pattern only weeds out binary files.
+	grep := []string{"grep", "-l", "-I", "-Z"}
+	if opts.Regex {
+		grep = append(grep, "-e", "")
+	} else {
+		grep = append(grep, "-F")
+		if opts.IgnoreCase {
+			grep = append(grep, "-i")
+		}
+		grep = append(grep, "-e", opts.Query)
+	}
+
+	cmd := []string{"find", dir, "-type", "f"}
+	cmd = append(cmd, nameTest(opts)...)
+	if opts.MaxSize > 0 {
+		cmd = append(cmd, "-size", "-"+strconv.FormatInt(opts.MaxSize+1, 10)+"c")
+	}
+	cmd = append(cmd, "-exec")
+	cmd = append(cmd, grep...)
+	cmd = append(cmd, "--", "{}", "+")
+
+	// Half of the time is left for reading the candidates.
+	result, err := s.exec(ctx, fullID, withTimeout(ctx, cmd, 2), docker.ExecOptions{MaxOutput: searchOutputLimit})
+	if err != nil {
+		return nil, err
+	}
+	output := completeRecords(result.Stdout, 1)
+	timedOut := slices.Contains(timeoutExitCodes, result.ExitCode)
+	// grep exits 1 for batches without a match, which find passes on.
+	if output == "" && result.ExitCode > 1 && !timedOut {
+		return nil, execError(cmd[0], result)
+	}
+
+	res := &SearchResult{Results: []SearchHit{}, Truncated: result.Truncated || timedOut, TimedOut: timedOut}
+	found := 0
+	for _, p := range strings.Split(strings.TrimSuffix(output, "\x00"), "\x00") {
+		if p == "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			res.Truncated = true
+			res.TimedOut = true
+			break
+		}
+		if found == opts.Limit {
+			res.Truncated = true
+			break
+		}
+
+		file, err := s.ReadFile(fullID, p, opts.MaxSize)
+		if err != nil {
+			// The file changed or vanished since find saw it.
+			continue
+		}
+		res.Scanned++
+		text, _, err := DecodeText(file.Data)
+		if err != nil {
+			continue
+		}
+
+		matches := findMatches(text, match, opts.Context, opts.Limit-found)
+		if len(matches) == 0 {
+			continue
+		}
+		found += len(matches)
+		res.Results = append(res.Results, SearchHit{
+			Path:    p,
+			Type:    TypeFile,
+			Size:    int64(len(file.Data)),
+			ModTime: file.ModTime.UTC(),
+			Matches: matches,
+		})
+	}
+	return res, nil
+}
+
+// withTimeout runs cmd under timeout(1) so that it stops inside the container
+// with 1/share of the time ctx has left, a second early at the latest. The
+// exec returns the output found so far then; cancelling ctx instead would
+// drop it and leave the command running.
+func withTimeout(ctx context.Context, cmd []string, share int) []string {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return cmd
+	}
+	left := time.Until(deadline)
+	secs := int(min(left/time.Duration(share), left-time.Second) / time.Second)
+	return append([]string{"timeout", strconv.Itoa(max(secs, 1))}, cmd...)
+}
+
+func nameTest(opts SearchOptions) []string {
+	if opts.Name == "" {
+		return nil
+	}
+	if opts.IgnoreCase {
+		return []string{"-iname", opts.Name}
+	}
+	return []string{"-name", opts.Name}
+}
+
+func lineMatcher(opts SearchOptions) (func(string) bool, error) {
+	if opts.Regex {
+		pattern := opts.Query
+		if opts.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, ErrPattern
+		}
+		return re.MatchString, nil
+	}
+	if opts.IgnoreCase {
+		query := strings.ToLower(opts.Query)
+		return func(line string) bool {
+			return strings.Contains(strings.ToLower(line), query)
+		}, nil
+	}
+	return func(line string) bool {
+		return strings.Contains(line, opts.Query)
+	}, nil
+}
+
+// findMatches returns up to limit matching lines of text with context lines
+// around each of them. Line numbers start at 1.
+func findMatches(text string, match func(string) bool, context, limit int) []SearchMatch {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var matches []SearchMatch
+	for i, line := range lines {
+		if len(matches) == limit {
+			break
+		}
+		if !match(line) {
+			continue
+		}
+		m := SearchMatch{Line: i + 1, Text: clipLine(line)}
+		for j := max(0, i-context); j < i; j++ {
+			m.Before = append(m.Before, clipLine(lines[j]))
+		}
+		for j := i + 1; j < len(lines) && j <= i+context; j++ {
+			m.After = append(m.After, clipLine(lines[j]))
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+func clipLine(line string) string {
+	if len(line) <= maxLineLength {
+		return line
+	}
+	cut := maxLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "…"
+}
+
+// completeRecords drops a partial record left at the end of output that was
+// cut at the output limit. Records are fields NUL-terminated fields long.
+func completeRecords(output string, fields int) string {
+	n := strings.Count(output, "\x00")
+	n -= n % fields
+	end := 0
+	for i := 0; i < n; i++ {
+		end += strings.IndexByte(output[end:], 0) + 1
+	}
+	return output[:end]
+}
@@ -0,0 +1,36 @@
+package files
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	cmd := []string{"find", "/data"}
+	tests := []struct {
+		name  string
+		left  time.Duration
+		share int
+		want  []string
+	}{
+		{"no deadline", 0, 1, cmd},
+		{"a second early", 10500 * time.Millisecond, 1, []string{"timeout", "9", "find", "/data"}},
+		{"half", 20500 * time.Millisecond, 2, []string{"timeout", "10", "find", "/data"}},
+		{"at least a second", 200 * time.Millisecond, 1, []string{"timeout", "1", "find", "/data"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.left > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.left)
+				defer cancel()
+			}
+			if got := withTimeout(ctx, cmd, tt.share); !slices.Equal(got, tt.want) {
+				t.Errorf("withTimeout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chi2l3s/cloudstrike/internal/docker"
+)
+
+// Usage is the disk usage of one entry of a directory, summed over
+// everything below it.
+type Usage struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+	// Names lists the regular files directly inside the entry.
+	Names   []string  `json:"names"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// usageFormat prints type, size, mtime and the path relative to the
+// starting directory, each NUL-terminated.
+const usageFormat = `%y\0%s\0%T@\0%P\0`
+
+// DirUsage returns the usage of every entry of dir, which must already be
+// resolved. A missing dir has no entries.
+func (s *Sandbox) DirUsage(ctx context.Context, fullID, dir string) ([]Usage, error) {
+	stat, err := s.docker.StatPath(fullID, dir)
+	if errors.Is(err, docker.ErrPathNotFound) {
+		return []Usage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !stat.Mode.IsDir() {
+		return nil, ErrNotDir
+	}
+
+	result, err := s.exec(ctx, fullID,
+		[]string{"find", dir, "-mindepth", "1", "-printf", usageFormat},
+		docker.ExecOptions{MaxOutput: listOutputLimit})
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, execError("find", result)
+	}
+	if result.Truncated {
+		return nil, errors.New("find: too many entries")
+	}
+
+	var order []string
+	byName := map[string]*Usage{}
+	fields := strings.Split(result.Stdout, "\x00")
+	for i := 0; i+4 <= len(fields); i += 4 {
+		kind, rel := fields[i], fields[i+3]
+		top, rest, nested := strings.Cut(rel, "/")
+
+		u := byName[top]
+		if u == nil {
+			u = &Usage{Name: top, Names: []string{}}
+			byName[top] = u
+			order = append(order, top)
+		}
+		mtime, _ := strconv.ParseFloat(fields[i+2], 64)
+		if t := time.Unix(0, int64(mtime*float64(time.Second))).UTC(); t.After(u.ModTime) {
+			u.ModTime = t
+		}
+		if kind != "f" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[i+1], 10, 64)
+		u.Size += size
+		u.Files++
+		if nested && !strings.Contains(rest, "/") {
+			u.Names = append(u.Names, rest)
+		}
+	}
+
+	usage := make([]Usage, 0, len(order))
+	for _, name := range order {
+		usage = append(usage, *byName[name])
+	}
+	return usage, nil
+}
@@ -0,0 +1,226 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished jobs are kept this long so clients can poll their outcome.
+const retention = time.Hour
+
+// Job is a snapshot of a long-running operation.
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	ServerID   string     `json:"serverId"`
+	Status     Status     `json:"status"`
+	Progress   float64    `json:"progress"`
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Result     any        `json:"result,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Reporter lets a running job publish its progress (0-100) and a status line.
+type Reporter interface {
+	Report(progress float64, message string)
+	SetResult(result any)
+}
+
+type Func func(ctx context.Context, r Reporter) error
+
+type entry struct {
+	job    Job
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type Manager struct {
+	jobs map[string]*entry
+	mu   sync.RWMutex
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		jobs: make(map[string]*entry),
+	}
+}
+
+// Start runs fn in the background and returns the new job's snapshot.
+func (m *Manager) Start(kind, serverID string, fn Func) Job {
+	m.mu.Lock()
+	e := m.add(kind, serverID)
+	snapshot := e.job
+	m.mu.Unlock()
+
+	m.run(e, fn)
+	return snapshot
+}
+
+// StartUnique is Start unless the server already has a running job of one of
+// the exclusive kinds, which is returned instead with false. The check and
+// the start happen under one lock, so concurrent calls start one job.
+func (m *Manager) StartUnique(kind, serverID string, exclusive []string, fn Func) (Job, bool) {
+	m.mu.Lock()
+	if job, ok := m.active(serverID, exclusive); ok {
+		m.mu.Unlock()
+		return job, false
+	}
+	e := m.add(kind, serverID)
+	snapshot := e.job
+	m.mu.Unlock()
+
+	m.run(e, fn)
+	return snapshot, true
+}
+
+// add registers a new running job. Callers must hold m.mu.
+func (m *Manager) add(kind, serverID string) *entry {
+	m.prune()
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &entry{
+		ctx:    ctx,
+		cancel: cancel,
+		job: Job{
+			ID:        newID(),
+			Kind:      kind,
+			ServerID:  serverID,
+			Status:    StatusRunning,
+			CreatedAt: time.Now(),
+		},
+	}
+	m.jobs[e.job.ID] = e
+	return e
+}
+
+// run runs fn for the job e in the background.
+func (m *Manager) run(e *entry, fn Func) {
+	go func() {
+		defer e.cancel()
+		err := fn(e.ctx, &reporter{m: m, e: e})
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		now := time.Now()
+		e.job.FinishedAt = &now
+		switch {
+		case err == nil:
+			e.job.Status = StatusSucceeded
+			e.job.Progress = 100
+		case errors.Is(err, context.Canceled):
+			e.job.Status = StatusCancelled
+			e.job.Error = err.Error()
+		default:
+			e.job.Status = StatusFailed
+			e.job.Error = err.Error()
+		}
+	}()
+}
+
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job, true
+}
+
+// List returns jobs newest first, optionally only those of one server.
+func (m *Manager) List(serverID string) []Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []Job{}
+	for _, e := range m.jobs {
+		if serverID == "" || e.job.ServerID == serverID {
+			list = append(list, e.job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Active returns a running job of one of the given kinds for the server.
+func (m *Manager) Active(serverID string, kinds ...string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.active(serverID, kinds)
+}
+
+// active is Active for callers that hold m.mu.
+func (m *Manager) active(serverID string, kinds []string) (Job, bool) {
+	for _, e := range m.jobs {
+		if e.job.ServerID != serverID || e.job.Status != StatusRunning {
+			continue
+		}
+		for _, kind := range kinds {
+			if e.job.Kind == kind {
+				return e.job, true
+			}
+		}
+	}
+	return Job{}, false
+}
+
+func (m *Manager) Cancel(id string) bool {
+	m.mu.RLock()
+	e, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	e.cancel()
+	return true
+}
+
+// prune drops finished jobs past retention. Callers must hold m.mu.
+func (m *Manager) prune() {
+	for id, e := range m.jobs {
+		if e.job.FinishedAt != nil && time.Since(*e.job.FinishedAt) > retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+type reporter struct {
+	m *Manager
+	e *entry
+}
+
+func (r *reporter) Report(progress float64, message string) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.e.job.Progress = progress
+	r.e.job.Message = message
+}
+
+func (r *reporter) SetResult(result any) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.e.job.Result = result
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
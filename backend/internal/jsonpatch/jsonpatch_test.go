@@ -0,0 +1,146 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		// err is set when the patch must fail; want is then unused.
+		err bool
+	}{
+		// add
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, false},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":[1]}]`, `{"a":[1]}`, false},
+		{"add nested", `{"a":{}}`, `[{"op":"add","path":"/a/b","value":null}]`, `{"a":{"b":null}}`, false},
+		{"add inserts into array", `[1,3]`, `[{"op":"add","path":"/1","value":2}]`, `[1,2,3]`, false},
+		{"add at array end", `[1]`, `[{"op":"add","path":"/1","value":2}]`, `[1,2]`, false},
+		{"add appends with -", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":{"b":2}}]`, `{"a":[1,{"b":2}]}`, false},
+		{"add - to empty array", `[]`, `[{"op":"add","path":"/-","value":1}]`, `[1]`, false},
+		{"add replaces root", `{"a":1}`, `[{"op":"add","path":"","value":[true]}]`, `[true]`, false},
+		{"add past array end", `[1]`, `[{"op":"add","path":"/2","value":2}]`, ``, true},
+		{"add leading zero index", `[1]`, `[{"op":"add","path":"/01","value":2}]`, ``, true},
+		{"add negative index", `[1]`, `[{"op":"add","path":"/-1","value":2}]`, ``, true},
+		{"add missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, ``, true},
+		{"add into scalar", `{"a":1}`, `[{"op":"add","path":"/a/b","value":1}]`, ``, true},
+		{"add without value", `{}`, `[{"op":"add","path":"/a"}]`, ``, true},
+
+		// remove
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, false},
+		{"remove array element", `[1,2,3]`, `[{"op":"remove","path":"/1"}]`, `[1,3]`, false},
+		{"remove nested", `{"a":{"b":[1,{"c":2}]}}`, `[{"op":"remove","path":"/a/b/1/c"}]`, `{"a":{"b":[1,{}]}}`, false},
+		{"remove missing member", `{}`, `[{"op":"remove","path":"/a"}]`, ``, true},
+		{"remove with -", `[1]`, `[{"op":"remove","path":"/-"}]`, ``, true},
+		{"remove root", `{}`, `[{"op":"remove","path":""}]`, ``, true},
+
+		// replace
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a":"x"}`, false},
+		{"replace array element", `[1,2]`, `[{"op":"replace","path":"/0","value":0}]`, `[0,2]`, false},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`, false},
+		{"replace missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, ``, true},
+		{"replace with -", `[1]`, `[{"op":"replace","path":"/-","value":1}]`, ``, true},
+
+		// move
+		{"move member", `{"a":1}`, `[{"op":"move","from":"/a","path":"/b"}]`, `{"b":1}`, false},
+		{"move between objects", `{"a":{"x":1},"b":{}}`, `[{"op":"move","from":"/a/x","path":"/b/y"}]`, `{"a":{},"b":{"y":1}}`, false},
+		{"move within array", `[1,2,3]`, `[{"op":"move","from":"/0","path":"/-"}]`, `[2,3,1]`, false},
+		{"move array element forward", `[1,2,3]`, `[{"op":"move","from":"/0","path":"/2"}]`, `[2,3,1]`, false},
+		{"move to itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":{"b":1}}`, false},
+		{"move into itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, ``, true},
+		{"move into own child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, ``, true},
+		{"move to a sibling with a longer name", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`, false},
+		{"move missing", `{}`, `[{"op":"move","from":"/a","path":"/b"}]`, ``, true},
+
+		// copy
+		{"copy member", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`, false},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/d","value":2}]`, `{"a":{"b":1},"c":{"b":1,"d":2}}`, false},
+		{"copy appends with -", `{"a":[1]}`, `[{"op":"copy","from":"/a/0","path":"/a/-"}]`, `{"a":[1,1]}`, false},
+		{"copy missing", `{}`, `[{"op":"copy","from":"/a","path":"/b"}]`, ``, true},
+
+		// test
+		{"test equal", `{"a":[1,{"b":"c"}]}`, `[{"op":"test","path":"/a","value":[1,{"b":"c"}]}]`, `{"a":[1,{"b":"c"}]}`, false},
+		{"test root", `[1]`, `[{"op":"test","path":"","value":[1]}]`, `[1]`, false},
+		{"test different", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ``, true},
+		{"test missing", `{}`, `[{"op":"test","path":"/a","value":null}]`, ``, true},
+
+		// pointers
+		{"escaped tokens", `{"a/b":1,"c~d":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/c~0d","value":3}]`, `{"c~d":3}`, false},
+		{"empty member name", `{"":1}`, `[{"op":"replace","path":"/","value":2}]`, `{"":2}`, false},
+		{"path without slash", `{}`, `[{"op":"add","path":"a","value":1}]`, ``, true},
+		{"unknown op", `{}`, `[{"op":"merge","path":"/a","value":1}]`, ``, true},
+
+		// numbers keep their text
+		{"numbers", `{"a":1.50,"b":12345678901234567890}`, `[{"op":"add","path":"/c","value":1e3}]`, `{"a":1.50,"b":12345678901234567890,"c":1e3}`, false},
+		{"empty patch", `{"a":1}`, `[]`, `{"a":1}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := Decode([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			got, err := Apply([]byte(tt.doc), ops)
+			if tt.err {
+				var perr *Error
+				if !errors.As(err, &perr) {
+					t.Fatalf("Apply = %s, %v, want an *Error", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if !bytes.Equal(got, compact(t, tt.want)) {
+				t.Errorf("Apply = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	patch := `[
+		{"op":"test","path":"/a","value":1},
+		{"op":"replace","path":"/a","value":2},
+		{"op":"test","path":"/a","value":1}
+	]`
+	ops, err := Decode([]byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := []byte(`{"a":1}`)
+	_, err = Apply(doc, ops)
+	var perr *Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("Apply error = %v, want an *Error", err)
+	}
+	if perr.Index != 2 || perr.Op != "test" || !errors.Is(err, ErrTestFailed) {
+		t.Errorf("Apply error = %v, want operation 2 (test) failing with ErrTestFailed", err)
+	}
+	if string(doc) != `{"a":1}` {
+		t.Errorf("Apply changed its input to %s", doc)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, patch := range []string{`{"op":"add"}`, `[{"op":1}]`, `nope`} {
+		if _, err := Decode([]byte(patch)); err == nil {
+			t.Errorf("Decode(%s) succeeded", patch)
+		}
+	}
+}
+
+func compact(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := json.Compact(&b, []byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,67 @@
+package keyvalues
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Format writes the document as KeyValues text, indented with tabs and with
+// every key and value quoted, except for directives such as #base.
+func Format(d *Document) []byte {
+	var b bytes.Buffer
+	writeNodes(&b, d.Nodes, 0)
+	for _, c := range d.EndComments {
+		b.WriteString("//" + c + "\n")
+	}
+	return b.Bytes()
+}
+
+func writeNodes(b *bytes.Buffer, nodes []*Node, depth int) {
+	indent := strings.Repeat("\t", depth)
+	for i, n := range nodes {
+		if n.BlankBefore && (i > 0 || depth == 0 && b.Len() > 0) {
+			b.WriteString("\n")
+		}
+		for _, c := range n.Comments {
+			b.WriteString(indent + "//" + c + "\n")
+		}
+
+		if isDirective(n.Key) {
+			b.WriteString(indent + n.Key)
+		} else {
+			b.WriteString(indent + `"` + n.Key + `"`)
+		}
+		if n.Value != nil {
+			b.WriteString("\t\t\"" + *n.Value + `"`)
+		}
+		if n.Condition != "" {
+			b.WriteString(" " + n.Condition)
+		}
+		writeComment(b, n.Comment)
+		b.WriteString("\n")
+		if n.Value != nil {
+			continue
+		}
+
+		b.WriteString(indent + "{\n")
+		writeNodes(b, n.Children, depth+1)
+		for _, c := range n.EndComments {
+			b.WriteString(indent + "\t//" + c + "\n")
+		}
+		b.WriteString(indent + "}")
+		writeComment(b, n.CloseComment)
+		b.WriteString("\n")
+	}
+}
+
+// isDirective reports whether key is a directive like #base or #include,
+// which the game only recognizes unquoted.
+func isDirective(key string) bool {
+	return strings.HasPrefix(key, "#") && !strings.ContainsAny(key, " \t\r\n{}\"")
+}
+
+func writeComment(b *bytes.Buffer, c string) {
+	if c != "" {
+		b.WriteString("\t//" + c)
+	}
+}
@@ -0,0 +1,229 @@
+// Package keyvalues reads and writes Valve's KeyValues (VDF) text format.
+//
+// Documents keep the order of their keys, duplicates, comments, blank lines
+// and platform conditions such as [$WIN32], so a file can be parsed, edited
+// and written back without losing anything but its exact whitespace. String
+// contents are kept raw: escape sequences such as \" are neither decoded
+// nor added.
+package keyvalues
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Document is a parsed file: its top-level nodes and the comments after the
+// last of them.
+type Document struct {
+	Nodes       []*Node  `json:"nodes"`
+	EndComments []string `json:"endComments,omitempty"`
+}
+
+// Node is a key with either a string value or a block of child nodes.
+// Comments hold the text after the // of each comment line.
+type Node struct {
+	Key string
+	// Value is set for key-value pairs; Children is non-nil for blocks.
+	Value    *string
+	Children []*Node
+	// Condition is a platform condition such as [$WIN32].
+	Condition string
+	// Comments are the comment lines right before the node.
+	Comments []string
+	// Comment is a comment on the line of the key.
+	Comment string
+	// EndComments are the comment lines before the closing brace of a block,
+	// CloseComment is a comment on the line of the closing brace.
+	EndComments  []string
+	CloseComment string
+	// BlankBefore keeps a blank line before the node and its comments.
+	BlankBefore bool
+}
+
+// nodeJSON is the JSON form of a node. Children is a pointer so an empty
+// block stays distinct from a value.
+type nodeJSON struct {
+	Key          string   `json:"key"`
+	Value        *string  `json:"value,omitempty"`
+	Children     *[]*Node `json:"children,omitempty"`
+	Condition    string   `json:"condition,omitempty"`
+	Comments     []string `json:"comments,omitempty"`
+	Comment      string   `json:"comment,omitempty"`
+	EndComments  []string `json:"endComments,omitempty"`
+	CloseComment string   `json:"closeComment,omitempty"`
+	BlankBefore  bool     `json:"blankBefore,omitempty"`
+}
+
+func (n *Node) MarshalJSON() ([]byte, error) {
+	j := nodeJSON{
+		Key:          n.Key,
+		Value:        n.Value,
+		Condition:    n.Condition,
+		Comments:     n.Comments,
+		Comment:      n.Comment,
+		EndComments:  n.EndComments,
+		CloseComment: n.CloseComment,
+		BlankBefore:  n.BlankBefore,
+	}
+	if n.Children != nil {
+		j.Children = &n.Children
+	}
+	return json.Marshal(j)
+}
+
+func (n *Node) UnmarshalJSON(data []byte) error {
+	var j nodeJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*n = Node{
+		Key:          j.Key,
+		Value:        j.Value,
+		Condition:    j.Condition,
+		Comments:     j.Comments,
+		Comment:      j.Comment,
+		EndComments:  j.EndComments,
+		CloseComment: j.CloseComment,
+		BlankBefore:  j.BlankBefore,
+	}
+	if j.Children != nil {
+		n.Children = *j.Children
+		if n.Children == nil {
+			n.Children = []*Node{}
+		}
+	}
+	return nil
+}
+
+// NewValue returns a key-value node.
+func NewValue(key, value string) *Node {
+	return &Node{Key: key, Value: &value}
+}
+
+// NewBlock returns a block node with the given children.
+func NewBlock(key string, children ...*Node) *Node {
+	if children == nil {
+		children = []*Node{}
+	}
+	return &Node{Key: key, Children: children}
+}
+
+// IsBlock reports whether the node holds child nodes rather than a value.
+func (n *Node) IsBlock() bool {
+	return n.Value == nil
+}
+
+// Child returns the first child with the given key, or nil.
+func (n *Node) Child(key string) *Node {
+	for _, c := range n.Children {
+		if c.Key == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// ValidationError names the node of a document that can't be written.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks that every node of the document can be written as valid
+// KeyValues: each is either a value or a block, and no string or comment
+// would end early.
+func (d *Document) Validate() error {
+	for _, c := range d.EndComments {
+		if err := checkComment(c); err != nil {
+			return &ValidationError{Path: "/endComments", Message: err.Error()}
+		}
+	}
+	return validateNodes(d.Nodes, "/nodes")
+}
+
+func validateNodes(nodes []*Node, path string) error {
+	for i, n := range nodes {
+		p := fmt.Sprintf("%s/%d", path, i)
+		if n == nil {
+			return &ValidationError{Path: p, Message: "node is null"}
+		}
+		if err := n.validate(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Node) validate(path string) error {
+	fail := func(msg string) error { return &ValidationError{Path: path, Message: msg} }
+
+	switch {
+	case n.Value != nil && n.Children != nil:
+		return fail("node has both a value and children")
+	case n.Value == nil && n.Children == nil:
+		return fail("node needs a value or children")
+	}
+	if err := checkString(n.Key); err != nil {
+		return fail("key " + err.Error())
+	}
+	if n.Value != nil {
+		if err := checkString(*n.Value); err != nil {
+			return fail("value " + err.Error())
+		}
+		if n.EndComments != nil || n.CloseComment != "" {
+			return fail("only blocks have end comments")
+		}
+	}
+	if n.Condition != "" && !isCondition(n.Condition) {
+		return fail("condition must look like [$WIN32] or [!$X360]")
+	}
+	for _, c := range append(append(append([]string{}, n.Comments...), n.EndComments...), n.Comment, n.CloseComment) {
+		if err := checkComment(c); err != nil {
+			return fail(err.Error())
+		}
+	}
+	return validateNodes(n.Children, path+"/children")
+}
+
+// checkString rejects strings that would end the quoted string they are
+// written in: an unescaped quote or a trailing backslash.
+func checkString(s string) error {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i == len(s)-1 {
+				return errors.New("must not end with a backslash")
+			}
+			i++
+		case '"':
+			return errors.New(`must escape quotes as \"`)
+		}
+	}
+	return nil
+}
+
+func checkComment(c string) error {
+	for _, r := range c {
+		if r == '\n' || r == '\r' {
+			return errors.New("comments must not contain line breaks")
+		}
+	}
+	return nil
+}
+
+func isCondition(s string) bool {
+	if len(s) < 3 || s[0] != '[' || s[len(s)-1] != ']' {
+		return false
+	}
+	for _, r := range s[1 : len(s)-1] {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '[' || r == ']' || r == '"' || r == '{' || r == '}' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,263 @@
+package keyvalues
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want *Document
+	}{
+		{
+			name: "empty",
+			src:  "",
+			want: &Document{Nodes: []*Node{}},
+		},
+		{
+			name: "unquoted",
+			src:  "key value",
+			want: &Document{Nodes: []*Node{NewValue("key", "value")}},
+		},
+		{
+			name: "block",
+			src:  "\"a\"\n{\n\t\"b\" \"1\"\n\t\"c\" {}\n}\n",
+			want: &Document{Nodes: []*Node{NewBlock("a", NewValue("b", "1"), NewBlock("c"))}},
+		},
+		{
+			name: "duplicate keys keep their order",
+			src:  `"k" "1" "k" "2"`,
+			want: &Document{Nodes: []*Node{NewValue("k", "1"), NewValue("k", "2")}},
+		},
+		{
+			name: "escapes stay raw",
+			src:  `"say" "\"hi\" \\ \n"`,
+			want: &Document{Nodes: []*Node{NewValue("say", `\"hi\" \\ \n`)}},
+		},
+		{
+			name: "conditions",
+			src:  "\"a\" \"1\" [$WIN32]\n\"b\" [!$X360]\n{\n}\n",
+			want: &Document{Nodes: []*Node{
+				{Key: "a", Value: ptr("1"), Condition: "[$WIN32]"},
+				{Key: "b", Children: []*Node{}, Condition: "[!$X360]"},
+			}},
+		},
+		{
+			name: "comments",
+			src:  "// file\n\"a\" // key\n{\n\t\"b\" \"1\" // value\n\n\t// before c\n\t\"c\" \"2\"\n\t// end\n} // close\n// tail\n",
+			want: &Document{
+				Nodes: []*Node{{
+					Key:     "a",
+					Comment: " key",
+					Children: []*Node{
+						{Key: "b", Value: ptr("1"), Comment: " value"},
+						{Key: "c", Value: ptr("2"), Comments: []string{" before c"}, BlankBefore: true},
+					},
+					Comments:     []string{" file"},
+					EndComments:  []string{" end"},
+					CloseComment: " close",
+				}},
+				EndComments: []string{" tail"},
+			},
+		},
+		{
+			name: "directives",
+			src:  "#base \"base.vdf\"\n\"a\" { #include \"x.vdf\" }",
+			want: &Document{Nodes: []*Node{NewValue("#base", "base.vdf"), NewBlock("a", NewValue("#include", "x.vdf"))}},
+		},
+		{
+			name: "byte order mark",
+			src:  "\ufeff\"a\" \"1\"",
+			want: &Document{Nodes: []*Node{NewValue("a", "1")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %s, want %s", dump(t, got), dump(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src          string
+		line, column int
+	}{
+		{`"a`, 1, 1},
+		{"\"a\"\n{\n\t\"b\" \"1\"\n", 4, 1},
+		{"}", 1, 1},
+		{"\"a\" {\n\t{\n}", 2, 2},
+		{`"a"`, 1, 4},
+		{`"a" }`, 1, 5},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, want a *SyntaxError", tt.src, err)
+			continue
+		}
+		if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+			t.Errorf("Parse(%q) error at %d:%d, want %d:%d", tt.src, syntaxErr.Line, syntaxErr.Column, tt.line, tt.column)
+		}
+	}
+}
+
+// TestRoundTrip checks that formatted files come back byte for byte.
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{
+			name: "values",
+			src:  "\"a\"\t\t\"1\"\n\"b\"\t\t\"\"\n",
+		},
+		{
+			name: "comments",
+			src: "// header\n" +
+				"\"GameModes_Server.txt\"\t// root\n" +
+				"{\n" +
+				"\t\"gameTypes\"\n" +
+				"\t{\n" +
+				"\t\t\"classic\"\t\t\"0\"\t// trailing\n" +
+				"\n" +
+				"\t\t// before\n" +
+				"\t\t// z\n" +
+				"\t\t\"z\"\t\t\"2\"\n" +
+				"\t\t// end of block\n" +
+				"\t}\t// close\n" +
+				"}\n" +
+				"// end of file\n",
+		},
+		{
+			name: "conditions",
+			src: "\"a\"\n" +
+				"{\n" +
+				"\t\"x\"\t\t\"1\" [$WIN32]\n" +
+				"\t\"x\"\t\t\"2\" [!$WIN32]\t// other platforms\n" +
+				"\t\"y\" [$X360]\n" +
+				"\t{\n" +
+				"\t}\n" +
+				"}\n",
+		},
+		{
+			name: "escapes",
+			src:  "\"say\"\t\t\"\\\"hi\\\" \\\\ there\"\n\"path\"\t\t\"maps\\\\de_dust2\"\n",
+		},
+		{
+			name: "directives stay unquoted",
+			src:  "#base\t\t\"file.vdf\"\n\"a\"\n{\n\t#include\t\t\"x.vdf\"\n\t\"#b c\"\t\t\"1\"\n}\n",
+		},
+		{
+			name: "blank lines between top-level nodes",
+			src:  "\"a\"\t\t\"1\"\n\n\"b\"\n{\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if err := doc.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got := string(Format(doc)); got != tt.src {
+				t.Errorf("Format(Parse(src)) =\n%s\nwant\n%s", got, tt.src)
+			}
+		})
+	}
+}
+
+// TestFormatStable checks that formatting any input once yields a fixed
+// point with the same content.
+func TestFormatStable(t *testing.T) {
+	tests := []string{
+		"key value",
+		"a { b c  d \"e\" }",
+		"\"a\" [$WIN32] { b 1 [$OSX] } // after\n",
+		"// only a comment",
+		"a\r\n{\r\n\tb \"c\" // d\r\n}\r\n",
+		"a {\n\n\n// x\n\n\tb 1\n// y\n}\n\n\nc 2\n",
+		`"s" "\"quoted\" and \\"`,
+		`"#base" "x.vdf"`,
+	}
+	for _, src := range tests {
+		doc, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", src, err)
+		}
+		once := Format(doc)
+		again, err := Parse(string(once))
+		if err != nil {
+			t.Fatalf("Parse(Format(%q)): %v", src, err)
+		}
+		if !reflect.DeepEqual(again, doc) {
+			t.Errorf("Parse(Format(%q)) = %s, want %s", src, dump(t, again), dump(t, doc))
+		}
+		if twice := Format(again); string(twice) != string(once) {
+			t.Errorf("Format is not stable for %q:\n%s\nthen\n%s", src, once, twice)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  *Document
+		path string
+	}{
+		{"valid", &Document{Nodes: []*Node{NewBlock("a", NewValue("b", `\"c\"`))}}, ""},
+		{"null node", &Document{Nodes: []*Node{nil}}, "/nodes/0"},
+		{"value and children", &Document{Nodes: []*Node{{Key: "a", Value: ptr("1"), Children: []*Node{}}}}, "/nodes/0"},
+		{"neither", &Document{Nodes: []*Node{{Key: "a"}}}, "/nodes/0"},
+		{"unescaped quote", &Document{Nodes: []*Node{NewBlock("a", NewValue("b", `say "hi"`))}}, "/nodes/0/children/0"},
+		{"trailing backslash", &Document{Nodes: []*Node{NewValue(`a\`, "1")}}, "/nodes/0"},
+		{"bad condition", &Document{Nodes: []*Node{{Key: "a", Value: ptr("1"), Condition: "WIN32"}}}, "/nodes/0"},
+		{"line break in comment", &Document{Nodes: []*Node{{Key: "a", Value: ptr("1"), Comment: "x\ny"}}}, "/nodes/0"},
+		{"end comment on a value", &Document{Nodes: []*Node{{Key: "a", Value: ptr("1"), EndComments: []string{"x"}}}}, "/nodes/0"},
+		{"document end comment", &Document{Nodes: []*Node{}, EndComments: []string{"\r"}}, "/endComments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.doc.Validate()
+			if tt.path == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate error = %v, want a *ValidationError", err)
+			}
+			if verr.Path != tt.path {
+				t.Errorf("Validate error path = %s, want %s", verr.Path, tt.path)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func dump(t *testing.T, d *Document) string {
+	t.Helper()
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,292 @@
+package keyvalues
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError is a parse error at a position of the input.
+type SyntaxError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokString
+	tokOpen
+	tokClose
+	tokComment
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	quoted bool
+	line   int
+	col    int
+	// newlines is how many line breaks came before the token since the
+	// previous one.
+	newlines int
+}
+
+func (t token) isCondition() bool {
+	return t.kind == tokString && !t.quoted && isCondition(t.text)
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+func (l *lexer) errorf(line, col int, format string, args ...any) error {
+	return &SyntaxError{Line: line, Column: col, Message: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) advance() byte {
+	c := l.src[l.pos]
+	l.pos++
+	if c == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return c
+}
+
+func (l *lexer) next() (token, error) {
+	newlines := 0
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			break
+		}
+		if c == '\n' {
+			newlines++
+		}
+		l.advance()
+	}
+	tok := token{line: l.line, col: l.col, newlines: newlines}
+	if l.pos >= len(l.src) {
+		tok.kind = tokEOF
+		return tok, nil
+	}
+
+	switch c := l.src[l.pos]; {
+	case c == '{':
+		l.advance()
+		tok.kind = tokOpen
+	case c == '}':
+		l.advance()
+		tok.kind = tokClose
+	case strings.HasPrefix(l.src[l.pos:], "//"):
+		l.advance()
+		l.advance()
+		start := l.pos
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.advance()
+		}
+		tok.kind = tokComment
+		tok.text = strings.TrimRight(l.src[start:l.pos], "\r")
+	case c == '"':
+		l.advance()
+		start := l.pos
+		for {
+			if l.pos >= len(l.src) {
+				return tok, l.errorf(tok.line, tok.col, "unterminated string")
+			}
+			c := l.advance()
+			if c == '\\' && l.pos < len(l.src) {
+				l.advance()
+				continue
+			}
+			if c == '"' {
+				break
+			}
+		}
+		tok.kind = tokString
+		tok.quoted = true
+		tok.text = l.src[start : l.pos-1]
+	default:
+		start := l.pos
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '{' || c == '}' || c == '"' {
+				break
+			}
+			l.advance()
+		}
+		tok.kind = tokString
+		tok.text = l.src[start:l.pos]
+	}
+	return tok, nil
+}
+
+type parser struct {
+	lex    lexer
+	peeked *token
+	// last is the node whose line the next same-line comment belongs to;
+	// lastClosed is set when that line is the closing brace of last.
+	last       *Node
+	lastClosed bool
+}
+
+// Parse reads a KeyValues document. A leading byte order mark is skipped.
+func Parse(src string) (*Document, error) {
+	p := &parser{lex: lexer{src: strings.TrimPrefix(src, "\ufeff"), line: 1, col: 1}}
+	nodes, end, err := p.parseBlock(false)
+	if err != nil {
+		return nil, err
+	}
+	if nodes == nil {
+		nodes = []*Node{}
+	}
+	return &Document{Nodes: nodes, EndComments: end}, nil
+}
+
+func (p *parser) next() (token, error) {
+	if p.peeked != nil {
+		t := *p.peeked
+		p.peeked = nil
+		return t, nil
+	}
+	return p.lex.next()
+}
+
+func (p *parser) peek() (token, error) {
+	if p.peeked == nil {
+		t, err := p.lex.next()
+		if err != nil {
+			return t, err
+		}
+		p.peeked = &t
+	}
+	return *p.peeked, nil
+}
+
+// attachTrailing makes a comment on the line of the previous token part of
+// that token's node. It reports false for comments on a line of their own.
+func (p *parser) attachTrailing(tok token) bool {
+	if tok.newlines > 0 || p.last == nil {
+		return false
+	}
+	switch {
+	case p.lastClosed && p.last.CloseComment == "":
+		p.last.CloseComment = tok.text
+	case !p.lastClosed && p.last.Comment == "":
+		p.last.Comment = tok.text
+	default:
+		return false
+	}
+	return true
+}
+
+// parseBlock reads nodes up to the closing brace of a block, or to the end
+// of the input at the top level. It returns the nodes and the comments
+// after the last of them.
+func (p *parser) parseBlock(inBlock bool) ([]*Node, []string, error) {
+	nodes := []*Node{}
+	var pending []string
+	pendingBlank := false
+
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch tok.kind {
+		case tokEOF:
+			if inBlock {
+				return nil, nil, p.lex.errorf(tok.line, tok.col, "unexpected end of file, expected }")
+			}
+			return nodes, pending, nil
+		case tokComment:
+			if p.attachTrailing(tok) {
+				continue
+			}
+			if len(pending) == 0 {
+				pendingBlank = tok.newlines > 1
+			}
+			pending = append(pending, tok.text)
+		case tokClose:
+			if !inBlock {
+				return nil, nil, p.lex.errorf(tok.line, tok.col, "unexpected }")
+			}
+			return nodes, pending, nil
+		case tokOpen:
+			return nil, nil, p.lex.errorf(tok.line, tok.col, "unexpected {, expected a key")
+		case tokString:
+			n := &Node{Key: tok.text, Comments: pending, BlankBefore: tok.newlines > 1}
+			if len(pending) > 0 {
+				n.BlankBefore = pendingBlank
+			}
+			// Blank lines only separate nodes; Format writes none before
+			// the first node of a block or file.
+			if len(nodes) == 0 {
+				n.BlankBefore = false
+			}
+			pending = nil
+			if err := p.parseNode(n, tok); err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, n)
+		}
+	}
+}
+
+// parseNode reads the value or block of the node whose key was keyTok.
+func (p *parser) parseNode(n *Node, keyTok token) error {
+	p.last, p.lastClosed = n, false
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case tok.kind == tokComment:
+			if !p.attachTrailing(tok) {
+				n.Comments = append(n.Comments, tok.text)
+			}
+		case tok.isCondition() && n.Condition == "":
+			n.Condition = tok.text
+		case tok.kind == tokString:
+			value := tok.text
+			n.Value = &value
+			p.last = n
+			// A condition may follow the value on the same line.
+			next, err := p.peek()
+			if err != nil {
+				return err
+			}
+			if next.isCondition() && next.newlines == 0 && n.Condition == "" {
+				p.next()
+				n.Condition = next.text
+			}
+			return nil
+		case tok.kind == tokOpen:
+			p.last = n
+			children, end, err := p.parseBlock(true)
+			if err != nil {
+				return err
+			}
+			n.Children = children
+			n.EndComments = end
+			p.last, p.lastClosed = n, true
+			return nil
+		case tok.kind == tokEOF:
+			return p.lex.errorf(tok.line, tok.col, "unexpected end of file, expected a value or { after key %q", keyTok.text)
+		default:
+			return p.lex.errorf(tok.line, tok.col, "unexpected }, expected a value or { after key %q", keyTok.text)
+		}
+	}
+}
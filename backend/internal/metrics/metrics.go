@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cloudstrike"
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of panel HTTP requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	dockerCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "docker",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of Docker API calls by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	dockerCallErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "docker",
+		Name:      "call_errors_total",
+		Help:      "Failed Docker API calls by operation.",
+	}, []string{"operation"})
+)
+
+// Handler serves all registered metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveHTTPRequest records the latency of a request served by the router.
+func ObserveHTTPRequest(route, method string, code int, d time.Duration) {
+	httpRequestDuration.WithLabelValues(route, method, strconv.Itoa(code)).Observe(d.Seconds())
+}
+
+// ObserveDockerCall records the latency and outcome of a Docker API call.
+func ObserveDockerCall(operation string, start time.Time, err error) {
+	dockerCallDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		dockerCallErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// RegisterRCONConnections exports the number of open RCON connections,
+// read from fn on every scrape.
+func RegisterRCONConnections(fn func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "rcon",
+		Name:      "active_connections",
+		Help:      "Number of open RCON connections held by the panel.",
+	}, func() float64 {
+		return float64(fn())
+	}))
+}
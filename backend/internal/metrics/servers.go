@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServerSample is a point-in-time snapshot of one game server.
+type ServerSample struct {
+	ID            string
+	Name          string
+	Up            bool
+	CPU           float64
+	Memory        uint64
+	MemoryLimit   uint64
+	NetworkRx     uint64
+	NetworkTx     uint64
+	Players       int
+	PlayersKnown  bool
+	RestartCount  int
+	RCONConnected bool
+}
+
+// ServerLister returns a fresh sample for every managed game server.
+type ServerLister func(ctx context.Context) ([]ServerSample, error)
+
+var (
+	serverLabels = []string{"server_id", "server_name"}
+
+	serverUpDesc = prometheus.NewDesc(namespace+"_server_up",
+		"Whether the server container is running (1) or not (0).", serverLabels, nil)
+	serverCPUDesc = prometheus.NewDesc(namespace+"_server_cpu_percent",
+		"CPU usage of the server container in percent.", serverLabels, nil)
+	serverMemoryDesc = prometheus.NewDesc(namespace+"_server_memory_bytes",
+		"Memory used by the server container.", serverLabels, nil)
+	serverMemoryLimitDesc = prometheus.NewDesc(namespace+"_server_memory_limit_bytes",
+		"Memory limit of the server container.", serverLabels, nil)
+	serverNetworkRxDesc = prometheus.NewDesc(namespace+"_server_network_receive_bytes_total",
+		"Bytes received by the server container.", serverLabels, nil)
+	serverNetworkTxDesc = prometheus.NewDesc(namespace+"_server_network_transmit_bytes_total",
+		"Bytes transmitted by the server container.", serverLabels, nil)
+	serverPlayersDesc = prometheus.NewDesc(namespace+"_server_players",
+		"Players connected to the server, as reported over RCON.", serverLabels, nil)
+	serverRestartsDesc = prometheus.NewDesc(namespace+"_server_restart_count",
+		"Number of times Docker restarted the server container.", serverLabels, nil)
+	serverRCONDesc = prometheus.NewDesc(namespace+"_server_rcon_connected",
+		"Whether the panel holds an RCON connection to the server.", serverLabels, nil)
+)
+
+type serverCollector struct {
+	list    ServerLister
+	timeout time.Duration
+	maxAge  time.Duration
+
+	mu        sync.Mutex
+	samples   []ServerSample
+	sampledAt time.Time
+}
+
+// RegisterServerCollector exports per-server gauges gathered by list. Samples
+// are reused for maxAge, so frequent scrapes don't load the servers.
+func RegisterServerCollector(list ServerLister, timeout, maxAge time.Duration) {
+	prometheus.MustRegister(&serverCollector{list: list, timeout: timeout, maxAge: maxAge})
+}
+
+func (c *serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serverUpDesc
+	ch <- serverCPUDesc
+	ch <- serverMemoryDesc
+	ch <- serverMemoryLimitDesc
+	ch <- serverNetworkRxDesc
+	ch <- serverNetworkTxDesc
+	ch <- serverPlayersDesc
+	ch <- serverRestartsDesc
+	ch <- serverRCONDesc
+}
+
+func (c *serverCollector) Collect(ch chan<- prometheus.Metric) {
+	samples, err := c.sample()
+	if err != nil {
+		// Report the servers seen last as down rather than dropping them,
+		// so alerts on cloudstrike_server_up fire.
+		log.Printf("metrics: failed to collect server samples: %v", err)
+		for _, s := range samples {
+			ch <- prometheus.MustNewConstMetric(serverUpDesc, prometheus.GaugeValue, 0, s.ID, s.Name)
+		}
+		return
+	}
+
+	for _, s := range samples {
+		labels := []string{s.ID, s.Name}
+		ch <- prometheus.MustNewConstMetric(serverUpDesc, prometheus.GaugeValue, boolToFloat(s.Up), labels...)
+		ch <- prometheus.MustNewConstMetric(serverRestartsDesc, prometheus.GaugeValue, float64(s.RestartCount), labels...)
+		ch <- prometheus.MustNewConstMetric(serverRCONDesc, prometheus.GaugeValue, boolToFloat(s.RCONConnected), labels...)
+		if !s.Up {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(serverCPUDesc, prometheus.GaugeValue, s.CPU, labels...)
+		ch <- prometheus.MustNewConstMetric(serverMemoryDesc, prometheus.GaugeValue, float64(s.Memory), labels...)
+		ch <- prometheus.MustNewConstMetric(serverMemoryLimitDesc, prometheus.GaugeValue, float64(s.MemoryLimit), labels...)
+		ch <- prometheus.MustNewConstMetric(serverNetworkRxDesc, prometheus.CounterValue, float64(s.NetworkRx), labels...)
+		ch <- prometheus.MustNewConstMetric(serverNetworkTxDesc, prometheus.CounterValue, float64(s.NetworkTx), labels...)
+		if s.PlayersKnown {
+			ch <- prometheus.MustNewConstMetric(serverPlayersDesc, prometheus.GaugeValue, float64(s.Players), labels...)
+		}
+	}
+}
+
+// sample returns the cached samples, or fresh ones once they are older than
+// maxAge. On error it returns the last samples it got.
+func (c *serverCollector) sample() ([]ServerSample, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.samples != nil && time.Since(c.sampledAt) < c.maxAge {
+		return c.samples, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	samples, err := c.list(ctx)
+	if err != nil {
+		return c.samples, err
+	}
+	if samples == nil {
+		samples = []ServerSample{}
+	}
+	c.samples = samples
+	c.sampledAt = time.Now()
+	return samples, nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+package presets
+
+// builtIn returns fresh copies of the presets shipped with the panel.
+func builtIn() []Preset {
+	return []Preset{
+		{
+			Name:        "competitive",
+			Description: "5v5 competitive match, MR24 with overtime",
+			BuiltIn:     true,
+			GameType:    "0",
+			GameMode:    "1",
+			MapGroup:    "mg_active",
+			Cvars: map[string]string{
+				"mp_maxrounds":        "24",
+				"mp_roundtime":        "1.92",
+				"mp_roundtime_defuse": "1.92",
+				"mp_freezetime":       "15",
+				"mp_buytime":          "20",
+				"mp_startmoney":       "800",
+				"mp_maxmoney":         "16000",
+				"mp_c4timer":          "40",
+				"mp_halftime":         "1",
+				"mp_overtime_enable":  "1",
+				"mp_match_can_clinch": "1",
+				"mp_friendlyfire":     "1",
+				"sv_alltalk":          "0",
+				"sv_deadtalk":         "0",
+				"bot_quota":           "0",
+			},
+		},
+		{
+			Name:        "wingman",
+			Description: "2v2 on a single bombsite, MR16",
+			BuiltIn:     true,
+			GameType:    "0",
+			GameMode:    "2",
+			MapGroup:    "mg_wingman",
+			Cvars: map[string]string{
+				"mp_maxrounds":        "16",
+				"mp_roundtime":        "1.5",
+				"mp_roundtime_defuse": "1.5",
+				"mp_freezetime":       "10",
+				"mp_buytime":          "15",
+				"mp_startmoney":       "800",
+				"mp_c4timer":          "40",
+				"mp_halftime":         "1",
+				"mp_overtime_enable":  "1",
+				"mp_friendlyfire":     "1",
+				"bot_quota":           "0",
+			},
+		},
+		{
+			Name:        "casual",
+			Description: "Casual 10v10 without friendly fire",
+			BuiltIn:     true,
+			GameType:    "0",
+			GameMode:    "0",
+			MapGroup:    "mg_active",
+			Cvars: map[string]string{
+				"mp_maxrounds":        "15",
+				"mp_roundtime":        "2.25",
+				"mp_roundtime_defuse": "2.25",
+				"mp_freezetime":       "6",
+				"mp_startmoney":       "1000",
+				"mp_friendlyfire":     "0",
+				"mp_autokick":         "0",
+				"mp_halftime":         "0",
+				"sv_alltalk":          "1",
+			},
+		},
+		{
+			Name:        "deathmatch",
+			Description: "Free respawns and buying anywhere, 10 minute maps",
+			BuiltIn:     true,
+			GameType:    "1",
+			GameMode:    "2",
+			MapGroup:    "mg_active",
+			Cvars: map[string]string{
+				"mp_timelimit":           "10",
+				"mp_roundtime":           "10",
+				"mp_freezetime":          "0",
+				"mp_buy_anywhere":        "1",
+				"mp_buytime":             "3600",
+				"mp_startmoney":          "16000",
+				"mp_respawn_on_death_ct": "1",
+				"mp_respawn_on_death_t":  "1",
+				"mp_death_drop_gun":      "0",
+				"mp_friendlyfire":        "0",
+			},
+		},
+		{
+			Name:        "retake",
+			Description: "Short rounds starting with a planted bomb; needs a retakes plugin",
+			BuiltIn:     true,
+			GameType:    "0",
+			GameMode:    "1",
+			MapGroup:    "mg_active",
+			Cvars: map[string]string{
+				"mp_maxrounds":        "30",
+				"mp_roundtime_defuse": "0.75",
+				"mp_freezetime":       "3",
+				"mp_warmuptime":       "15",
+				"mp_halftime":         "0",
+				"mp_match_can_clinch": "0",
+				"mp_overtime_enable":  "0",
+				"mp_autoteambalance":  "0",
+				"mp_friendlyfire":     "0",
+				"bot_quota":           "0",
+			},
+		},
+		{
+			Name:        "practice",
+			Description: "Solo practice: cheats, infinite ammo and money, grenade previews",
+			BuiltIn:     true,
+			GameType:    "0",
+			GameMode:    "1",
+			MapGroup:    "mg_active",
+			Cvars: map[string]string{
+				"sv_cheats":                            "1",
+				"sv_infinite_ammo":                     "1",
+				"sv_grenade_trajectory_prac_pipreview": "1",
+				"sv_showimpacts":                       "1",
+				"ammo_grenade_limit_total":             "5",
+				"mp_buy_anywhere":                      "1",
+				"mp_buytime":                           "3600",
+				"mp_startmoney":                        "65535",
+				"mp_maxmoney":                          "65535",
+				"mp_freezetime":                        "0",
+				"mp_roundtime":                         "60",
+				"mp_roundtime_defuse":                  "60",
+				"mp_warmup_pausetimer":                 "1",
+				"mp_respawn_on_death_ct":               "1",
+				"mp_respawn_on_death_t":                "1",
+				"mp_limitteams":                        "0",
+				"mp_autoteambalance":                   "0",
+				"bot_quota":                            "0",
+			},
+		},
+	}
+}
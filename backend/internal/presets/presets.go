@@ -0,0 +1,160 @@
+package presets
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound = errors.New("preset not found")
+	ErrBuiltIn  = errors.New("built-in presets can't be changed")
+	ErrName     = errors.New("preset names are 1-32 lowercase letters, digits, - and _")
+)
+
+// Preset bundles the game mode, map group and cvars of one way to play.
+type Preset struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	BuiltIn     bool              `json:"builtIn"`
+	GameType    string            `json:"gameType"`
+	GameMode    string            `json:"gameMode"`
+	MapGroup    string            `json:"mapGroup,omitempty"`
+	Map         string            `json:"map,omitempty"`
+	Cvars       map[string]string `json:"cvars"`
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Store keeps custom presets as dir/<name>.json next to the built-in ones.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// List returns the built-in presets followed by the custom ones by name.
+func (s *Store) List() ([]Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := builtIn()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !namePattern.MatchString(name) {
+			continue
+		}
+		p, err := s.read(name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *p)
+	}
+	return list, nil
+}
+
+func (s *Store) Get(name string) (*Preset, error) {
+	if i := slices.IndexFunc(builtIn(), func(p Preset) bool { return p.Name == name }); i >= 0 {
+		p := builtIn()[i]
+		return &p, nil
+	}
+	if !namePattern.MatchString(name) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(name)
+}
+
+// Save creates or replaces a custom preset. The caller validates its fields.
+func (s *Store) Save(p Preset) error {
+	if !namePattern.MatchString(p.Name) {
+		return ErrName
+	}
+	if IsBuiltIn(p.Name) {
+		return ErrBuiltIn
+	}
+	p.BuiltIn = false
+	if p.Cvars == nil {
+		p.Cvars = map[string]string{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.path(p.Name)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *Store) Delete(name string) error {
+	if IsBuiltIn(name) {
+		return ErrBuiltIn
+	}
+	if !namePattern.MatchString(name) {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *Store) read(name string) (*Preset, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Preset
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	p.Name = name
+	if p.Cvars == nil {
+		p.Cvars = map[string]string{}
+	}
+	return &p, nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+func IsBuiltIn(name string) bool {
+	return slices.ContainsFunc(builtIn(), func(p Preset) bool { return p.Name == name })
+}
+
+// ValidName reports whether name can be used for a custom preset.
+func ValidName(name string) bool {
+	return namePattern.MatchString(name) && !IsBuiltIn(name)
+}
@@ -84,3 +84,9 @@ func (m *Manager) IsConnected(serverID string) bool {
 	_, exists := m.connections[serverID]
 	return exists
 }
+
+func (m *Manager) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.connections)
+}
@@ -0,0 +1,43 @@
+package rcon
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Status holds the fields of the `status` command output the panel cares about.
+type Status struct {
+	Players    int
+	Bots       int
+	MaxPlayers int
+	Map        string
+}
+
+var (
+	playersLine    = regexp.MustCompile(`(?m)^players\s*:\s*(\d+)\s+humans?,\s*(\d+)\s+bots?\s*\((\d+)\s+max\)`)
+	mapLine        = regexp.MustCompile(`(?m)^map\s*:\s*(\S+)`)
+	spawnGroupLine = regexp.MustCompile(`(?m)^loaded spawngroup\(\s*1\)\s*:\s*SV:\s*\[1:\s*([^\s|]+)`)
+)
+
+// ParseStatus extracts player counts and the current map from the output of
+// the `status` RCON command. It reports false if no player line was found.
+func ParseStatus(output string) (Status, bool) {
+	var status Status
+
+	m := playersLine.FindStringSubmatch(output)
+	if m == nil {
+		return status, false
+	}
+	status.Players, _ = strconv.Atoi(m[1])
+	status.Bots, _ = strconv.Atoi(m[2])
+	status.MaxPlayers, _ = strconv.Atoi(m[3])
+
+	if m := mapLine.FindStringSubmatch(output); m != nil {
+		status.Map = strings.TrimSpace(m[1])
+	} else if m := spawnGroupLine.FindStringSubmatch(output); m != nil {
+		status.Map = strings.TrimSpace(m[1])
+	}
+
+	return status, true
+}
@@ -0,0 +1,273 @@
+package revisions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+var (
+	ErrNotFound  = errors.New("revision not found")
+	ErrServerKey = errors.New("invalid server key")
+)
+
+// Actions recorded with a revision. Initial and external revisions hold
+// content found in the container before a write: the original file and
+// changes made outside the panel.
+const (
+	ActionInitial  = "initial"
+	ActionExternal = "external"
+	ActionWrite    = "write"
+	ActionUpload   = "upload"
+	ActionCopy     = "copy"
+	ActionMove     = "move"
+	ActionRevert   = "revert"
+)
+
+// Revision is one stored version of a file.
+type Revision struct {
+	ID        int       `json:"id"`
+	Path      string    `json:"path"`
+	Author    string    `json:"author"`
+	Action    string    `json:"action"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Store keeps file histories on the panel host. Every file has its own
+// directory under dir/<server>/ named after the hash of its path, holding
+// index.json and one <sha256>.blob per distinct content.
+type Store struct {
+	dir string
+	max int
+
+	mu sync.Mutex
+}
+
+// NewStore opens the store in dir. Histories are trimmed to the newest max
+// revisions per file; zero keeps everything.
+func NewStore(dir string, max int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, max: max}, nil
+}
+
+// Record stores data as the newest revision of path. Content equal to the
+// newest revision is not stored again; the existing revision is returned
+// with false.
+func (s *Store) Record(server, path, author, action string, data []byte) (*Revision, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.load(server, path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if n := len(index); n > 0 && index[n-1].SHA256 == hash {
+		return &index[n-1], false, nil
+	}
+
+	dir, err := s.fileDir(server, path)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, false, err
+	}
+	if err := writeFile(filepath.Join(dir, hash+".blob"), data); err != nil {
+		return nil, false, err
+	}
+
+	id := 1
+	if n := len(index); n > 0 {
+		id = index[n-1].ID + 1
+	}
+	rev := Revision{
+		ID:        id,
+		Path:      path,
+		Author:    author,
+		Action:    action,
+		Size:      int64(len(data)),
+		SHA256:    hash,
+		CreatedAt: time.Now().UTC(),
+	}
+	index = append(index, rev)
+
+	var dropped []Revision
+	if s.max > 0 && len(index) > s.max {
+		dropped = index[:len(index)-s.max]
+		index = index[len(index)-s.max:]
+	}
+	if err := s.save(server, path, index); err != nil {
+		return nil, false, err
+	}
+	s.removeBlobs(dir, dropped, index)
+	return &rev, true, nil
+}
+
+// List returns the revisions of path, newest first.
+func (s *Store) List(server, path string) ([]Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.load(server, path)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Revision, len(index))
+	for i, rev := range index {
+		list[len(index)-1-i] = rev
+	}
+	return list, nil
+}
+
+// Get returns revision id of path and its content.
+func (s *Store) Get(server, path string, id int) (*Revision, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.load(server, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rev := range index {
+		if rev.ID != id {
+			continue
+		}
+		dir, err := s.fileDir(server, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, rev.SHA256+".blob"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return &rev, data, nil
+	}
+	return nil, nil, ErrNotFound
+}
+
+// RemoveServer drops the histories of every file of server.
+func (s *Store) RemoveServer(server string) error {
+	dir, err := s.serverDir(server)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// Diff returns a unified diff turning a into b.
+func Diff(a, b []byte, nameA, nameB string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(a)),
+		B:        splitLines(string(b)),
+		FromFile: nameA,
+		ToFile:   nameB,
+		Context:  3,
+	})
+}
+
+// splitLines splits text after every newline. A last line without one gets
+// it added, as the diff expects every line to be terminated.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n"
+	}
+	return lines
+}
+
+func (s *Store) load(server, path string) ([]Revision, error) {
+	dir, err := s.fileDir(server, path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index []Revision
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (s *Store) save(server, path string, index []Revision) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	dir, err := s.fileDir(server, path)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "index.json"), data)
+}
+
+// removeBlobs deletes the content of dropped revisions that no kept
+// revision shares.
+func (s *Store) removeBlobs(dir string, dropped, kept []Revision) {
+	used := make(map[string]bool, len(kept))
+	for _, rev := range kept {
+		used[rev.SHA256] = true
+	}
+	for _, rev := range dropped {
+		if !used[rev.SHA256] {
+			os.Remove(filepath.Join(dir, rev.SHA256+".blob"))
+		}
+	}
+}
+
+// serverDir is the directory holding the histories of server. Keys that
+// aren't a single path element are refused, so no key reaches outside dir
+// or names dir itself.
+func (s *Store) serverDir(server string) (string, error) {
+	if server == "" || server == "." || server == ".." || filepath.Base(server) != server {
+		return "", ErrServerKey
+	}
+	return filepath.Join(s.dir, server), nil
+}
+
+func (s *Store) fileDir(server, path string) (string, error) {
+	dir, err := s.serverDir(server)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])), nil
+}
+
+func writeFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
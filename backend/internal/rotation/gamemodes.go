@@ -0,0 +1,32 @@
+package rotation
+
+import (
+	"strings"
+
+	"github.com/chi2l3s/cloudstrike/internal/keyvalues"
+)
+
+// ManagedHeader starts every gamemodes_server.txt written by Render, so the
+// panel can tell its own file from one written by hand.
+const ManagedHeader = "// Managed by Cloud Strike; edit the map pools instead."
+
+// Render writes the pools as the mapgroups of a gamemodes_server.txt, one
+// mapgroup per pool named by Pool.MapGroup.
+func Render(pools []Pool) []byte {
+	groups := keyvalues.NewBlock("mapgroups")
+	for _, p := range pools {
+		maps := keyvalues.NewBlock("maps")
+		for _, entry := range p.Maps {
+			maps.Children = append(maps.Children, keyvalues.NewValue(entry, ""))
+		}
+		groups.Children = append(groups.Children, keyvalues.NewBlock(p.MapGroup(), keyvalues.NewValue("name", p.MapGroup()), maps))
+	}
+	root := keyvalues.NewBlock("GameModes_Server.txt", groups)
+	root.Comments = []string{strings.TrimPrefix(ManagedHeader, "//")}
+	return keyvalues.Format(&keyvalues.Document{Nodes: []*keyvalues.Node{root}})
+}
+
+// IsManaged reports whether data was written by Render.
+func IsManaged(data []byte) bool {
+	return strings.HasPrefix(strings.TrimPrefix(string(data), "\ufeff"), ManagedHeader)
+}
@@ -0,0 +1,326 @@
+package rotation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("map pool not found")
+	ErrInUse    = errors.New("map pool is used by a server rotation")
+	ErrName     = errors.New("map pool names are 1-32 lowercase letters, digits and _")
+)
+
+// Mode is how a rotation picks the next map.
+type Mode string
+
+const (
+	Order  Mode = "order"
+	Random Mode = "random"
+)
+
+// Pool is a named list of maps. Each entry is a map name such as de_mirage
+// or a workshop map as workshop/<id>, optionally followed by /<name>.
+type Pool struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Maps        []string `json:"maps"`
+}
+
+// MapGroup is the name of the pool's mapgroup in gamemodes_server.txt.
+func (p Pool) MapGroup() string {
+	return "mg_" + p.Name
+}
+
+func (p Pool) Validate() error {
+	if !namePattern.MatchString(p.Name) {
+		return ErrName
+	}
+	if len(p.Maps) == 0 {
+		return errors.New("map pool needs at least one map")
+	}
+	for _, entry := range p.Maps {
+		if _, err := ParseMap(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rotation is how a server moves through a pool.
+type Rotation struct {
+	Pool string `json:"pool"`
+	Mode Mode   `json:"mode"`
+	// IntervalMinutes changes the map on a schedule; 0 rotates only on
+	// request.
+	IntervalMinutes int `json:"intervalMinutes"`
+	// OnlyWhenEmpty skips scheduled rotations while players are connected.
+	OnlyWhenEmpty bool      `json:"onlyWhenEmpty"`
+	LastMap       string    `json:"lastMap,omitempty"`
+	LastRotated   time.Time `json:"lastRotated"`
+}
+
+func (r Rotation) Validate() error {
+	if r.Mode != Order && r.Mode != Random {
+		return fmt.Errorf("mode must be %s or %s", Order, Random)
+	}
+	if r.IntervalMinutes < 0 || r.IntervalMinutes > 7*24*60 {
+		return errors.New("intervalMinutes must be between 0 and 10080")
+	}
+	return nil
+}
+
+// NextAt returns when the next scheduled rotation is due, or the zero time
+// if the rotation has no schedule.
+func (r Rotation) NextAt() time.Time {
+	if r.IntervalMinutes == 0 {
+		return time.Time{}
+	}
+	return r.LastRotated.Add(time.Duration(r.IntervalMinutes) * time.Minute)
+}
+
+func (r Rotation) Due(now time.Time) bool {
+	next := r.NextAt()
+	return !next.IsZero() && !now.Before(next)
+}
+
+// Map is a parsed pool entry.
+type Map struct {
+	Name       string `json:"name,omitempty"`
+	WorkshopID string `json:"workshopId,omitempty"`
+}
+
+var (
+	namePattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9_]{0,31}$`)
+	mapPattern     = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+	workshopPrefix = "workshop/"
+)
+
+// ParseMap parses a pool entry.
+func ParseMap(entry string) (Map, error) {
+	rest, ok := strings.CutPrefix(entry, workshopPrefix)
+	if !ok {
+		if !mapPattern.MatchString(entry) {
+			return Map{}, fmt.Errorf("invalid map name %q", entry)
+		}
+		return Map{Name: entry}, nil
+	}
+	id, name, _ := strings.Cut(rest, "/")
+	if !isWorkshopID(id) || (name != "" && !mapPattern.MatchString(name)) {
+		return Map{}, fmt.Errorf("invalid workshop map %q, expected workshop/<id> or workshop/<id>/<name>", entry)
+	}
+	return Map{Name: name, WorkshopID: id}, nil
+}
+
+func isWorkshopID(id string) bool {
+	if id == "" || len(id) > 20 {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Command returns the console command that changes to the map.
+func (m Map) Command() string {
+	if m.WorkshopID != "" {
+		return "host_workshop_map " + m.WorkshopID
+	}
+	return "changelevel " + m.Name
+}
+
+// Is reports whether current, the map the server reports as loaded, is m.
+func (m Map) Is(current string) bool {
+	if current == "" {
+		return false
+	}
+	if m.Name != "" && (current == m.Name || strings.HasSuffix(current, "/"+m.Name)) {
+		return true
+	}
+	return m.WorkshopID != "" && strings.Contains(current, m.WorkshopID)
+}
+
+// Next picks the map that follows current in the pool: the next entry in
+// order mode, wrapping around, or any other entry in random mode. An
+// unknown current map starts the order from the top.
+func Next(pool Pool, mode Mode, current string) string {
+	if len(pool.Maps) == 0 {
+		return ""
+	}
+	i := slices.IndexFunc(pool.Maps, func(entry string) bool {
+		m, err := ParseMap(entry)
+		return err == nil && m.Is(current)
+	})
+	if mode == Random {
+		candidates := slices.Clone(pool.Maps)
+		if i >= 0 && len(candidates) > 1 {
+			candidates = slices.Delete(candidates, i, i+1)
+		}
+		return candidates[rand.IntN(len(candidates))]
+	}
+	return pool.Maps[(i+1)%len(pool.Maps)]
+}
+
+// Store keeps the map pools as dir/pools/<name>.json and the rotation of
+// every server as dir/servers/<server>.json.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) (*Store, error) {
+	for _, sub := range []string{"pools", "servers"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Pools returns every pool by name.
+func (s *Store) Pools() ([]Pool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "pools"))
+	if err != nil {
+		return nil, err
+	}
+	pools := []Pool{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !namePattern.MatchString(name) {
+			continue
+		}
+		var p Pool
+		if err := readJSON(s.poolPath(name), &p); err != nil {
+			return nil, err
+		}
+		p.Name = name
+		pools = append(pools, p)
+	}
+	return pools, nil
+}
+
+func (s *Store) Pool(name string) (Pool, error) {
+	if !namePattern.MatchString(name) {
+		return Pool{}, ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var p Pool
+	err := readJSON(s.poolPath(name), &p)
+	if errors.Is(err, os.ErrNotExist) {
+		return Pool{}, ErrNotFound
+	}
+	p.Name = name
+	return p, err
+}
+
+func (s *Store) PutPool(p Pool) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeJSON(s.poolPath(p.Name), p)
+}
+
+// DeletePool removes a pool no server rotates through.
+func (s *Store) DeletePool(name string) error {
+	if !namePattern.MatchString(name) {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "servers"))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var r Rotation
+		if err := readJSON(filepath.Join(s.dir, "servers", e.Name()), &r); err == nil && r.Pool == name {
+			return ErrInUse
+		}
+	}
+
+	err = os.Remove(s.poolPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Rotation returns the rotation of server and whether one was saved.
+func (s *Store) Rotation(server string) (Rotation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var r Rotation
+	err := readJSON(s.serverPath(server), &r)
+	if errors.Is(err, os.ErrNotExist) {
+		return Rotation{}, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (s *Store) PutRotation(server string, r Rotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeJSON(s.serverPath(server), r)
+}
+
+func (s *Store) RemoveRotation(server string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.serverPath(server))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) poolPath(name string) string {
+	return filepath.Join(s.dir, "pools", name+".json")
+}
+
+func (s *Store) serverPath(server string) string {
+	return filepath.Join(s.dir, "servers", filepath.Base(server)+".json")
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,279 @@
+package uploads
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("offset does not match the uploaded size")
+	ErrTooLarge       = errors.New("chunk goes past the declared size")
+	ErrIncomplete     = errors.New("upload is not complete")
+	ErrChecksum       = errors.New("checksum mismatch")
+)
+
+// Upload is a file being uploaded in chunks. It is staged on the panel host
+// and survives panel restarts until it completes or expires. ServerID is the
+// server's ID, which stays the same when its container is re-created.
+type Upload struct {
+	ID        string    `json:"id"`
+	ServerID  string    `json:"serverId"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Overwrite bool      `json:"overwrite"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Store keeps staged uploads in dir: <id>.part holds the data received so
+// far and <id>.json the metadata.
+type Store struct {
+	dir string
+	ttl time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func NewStore(dir string, ttl time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, ttl: ttl, locks: make(map[string]*sync.Mutex)}
+	s.prune()
+	return s, nil
+}
+
+// Create registers a new upload of size bytes to path.
+func (s *Store) Create(serverID, path string, size int64, checksum string, overwrite bool) (*Upload, error) {
+	s.prune()
+
+	now := time.Now()
+	u := &Upload{
+		ID:        newID(),
+		ServerID:  serverID,
+		Path:      path,
+		Size:      size,
+		SHA256:    strings.ToLower(checksum),
+		Overwrite: overwrite,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+
+	f, err := os.OpenFile(s.partPath(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if err := s.save(u); err != nil {
+		os.Remove(s.partPath(u.ID))
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *Store) Get(id string) (*Upload, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.metaPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	if time.Now().After(u.ExpiresAt) {
+		s.Remove(id)
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+// Append writes a chunk that must start at the current offset. When
+// checksum is set, the chunk is only kept if its SHA-256 matches.
+func (s *Store) Append(id string, offset int64, chunk io.Reader, checksum string) (*Upload, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// Drop any tail left by an interrupted chunk.
+	if err := f.Truncate(u.Offset); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(u.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	remaining := u.Size - u.Offset
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(chunk, remaining+1))
+	if err != nil {
+		f.Truncate(u.Offset)
+		return u, err
+	}
+	if n > remaining {
+		f.Truncate(u.Offset)
+		return u, ErrTooLarge
+	}
+	if checksum != "" && !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), checksum) {
+		f.Truncate(u.Offset)
+		return u, ErrChecksum
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+
+	u.Offset += n
+	u.ExpiresAt = time.Now().Add(s.ttl)
+	if err := s.save(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Open returns the staged data of a complete upload after verifying its
+// checksum. The caller must close the file.
+func (s *Store) Open(id string) (*Upload, *os.File, error) {
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Offset != u.Size {
+		return u, nil, ErrIncomplete
+	}
+
+	f, err := os.Open(s.partPath(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.SHA256 != "" {
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != u.SHA256 {
+			f.Close()
+			return u, nil, ErrChecksum
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	}
+	return u, f, nil
+}
+
+// Lock serializes work on one upload and returns the unlock function.
+func (s *Store) Lock(id string) func() {
+	return s.lock(id)
+}
+
+func (s *Store) Remove(id string) {
+	if !validID(id) {
+		return
+	}
+	os.Remove(s.partPath(id))
+	os.Remove(s.metaPath(id))
+
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+}
+
+func (s *Store) lock(id string) func() {
+	s.mu.Lock()
+	mu, ok := s.locks[id]
+	if !ok {
+		mu = &sync.Mutex{}
+		s.locks[id] = mu
+	}
+	s.mu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (s *Store) save(u *Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := s.metaPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.metaPath(u.ID))
+}
+
+// prune removes expired uploads and orphaned data files.
+func (s *Store) prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("Failed to read upload directory: %v", err)
+		return
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".part")
+		if !ok {
+			continue
+		}
+		if _, err := s.Get(id); errors.Is(err, ErrNotFound) {
+			s.Remove(id)
+		}
+	}
+}
+
+func (s *Store) partPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+func (s *Store) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validID keeps ids from the URL from naming files outside the store.
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,54 @@
+package workshop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// MockSource serves metadata from memory. Collections are items with
+// Children.
+type MockSource struct {
+	items map[string]Item
+}
+
+func NewMockSource(items ...Item) *MockSource {
+	m := &MockSource{items: make(map[string]Item, len(items))}
+	for _, item := range items {
+		m.items[item.ID] = item
+	}
+	return m
+}
+
+// LoadMockSource reads a JSON array of Item from path, for running the panel
+// without access to Steam.
+func LoadMockSource(path string) (*MockSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("parse workshop mock: %w", err)
+	}
+	return NewMockSource(items...), nil
+}
+
+func (m *MockSource) Items(ctx context.Context, ids []string) ([]Item, error) {
+	items := []Item{}
+	for _, id := range ids {
+		if item, ok := m.items[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *MockSource) Collection(ctx context.Context, id string) ([]string, error) {
+	item, ok := m.items[id]
+	if !ok || item.Children == nil {
+		return nil, fmt.Errorf("workshop collection %s not found", id)
+	}
+	return item.Children, nil
+}
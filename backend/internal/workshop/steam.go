@@ -0,0 +1,136 @@
+package workshop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SteamSource reads workshop metadata from the Steam Web API. The endpoints
+// used here need no API key.
+type SteamSource struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewSteamSource(baseURL string) *SteamSource {
+	return &SteamSource{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Steam returns numbers as strings in some fields and as numbers in others.
+type flexInt int64
+
+func (n *flexInt) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*n = flexInt(v)
+	return nil
+}
+
+type publishedFile struct {
+	ID         string  `json:"publishedfileid"`
+	Result     int     `json:"result"`
+	AppID      int     `json:"consumer_app_id"`
+	Title      string  `json:"title"`
+	Size       flexInt `json:"file_size"`
+	PreviewURL string  `json:"preview_url"`
+	Updated    int64   `json:"time_updated"`
+	Tags       []struct {
+		Tag string `json:"tag"`
+	} `json:"tags"`
+}
+
+func (s *SteamSource) Items(ctx context.Context, ids []string) ([]Item, error) {
+	if len(ids) == 0 {
+		return []Item{}, nil
+	}
+	form := url.Values{"itemcount": {strconv.Itoa(len(ids))}}
+	for i, id := range ids {
+		form.Set(fmt.Sprintf("publishedfileids[%d]", i), id)
+	}
+
+	var resp struct {
+		Response struct {
+			Details []publishedFile `json:"publishedfiledetails"`
+		} `json:"response"`
+	}
+	if err := s.post(ctx, "/ISteamRemoteStorage/GetPublishedFileDetails/v1/", form, &resp); err != nil {
+		return nil, err
+	}
+
+	items := []Item{}
+	for _, f := range resp.Response.Details {
+		// Result 1 is k_EResultOK; deleted or hidden files report 9.
+		if f.Result != 1 {
+			continue
+		}
+		item := Item{
+			ID:         f.ID,
+			Title:      f.Title,
+			Size:       int64(f.Size),
+			PreviewURL: f.PreviewURL,
+			AppID:      f.AppID,
+			Updated:    time.Unix(f.Updated, 0).UTC(),
+		}
+		for _, t := range f.Tags {
+			item.Tags = append(item.Tags, t.Tag)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s *SteamSource) Collection(ctx context.Context, id string) ([]string, error) {
+	form := url.Values{"collectioncount": {"1"}, "publishedfileids[0]": {id}}
+
+	var resp struct {
+		Response struct {
+			Details []struct {
+				Result   int `json:"result"`
+				Children []struct {
+					ID string `json:"publishedfileid"`
+				} `json:"children"`
+			} `json:"collectiondetails"`
+		} `json:"response"`
+	}
+	if err := s.post(ctx, "/ISteamRemoteStorage/GetCollectionDetails/v1/", form, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Response.Details) == 0 || resp.Response.Details[0].Result != 1 {
+		return nil, fmt.Errorf("workshop collection %s not found", id)
+	}
+
+	children := []string{}
+	for _, c := range resp.Response.Details[0].Children {
+		children = append(children, c.ID)
+	}
+	return children, nil
+}
+
+func (s *SteamSource) post(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("steam api: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
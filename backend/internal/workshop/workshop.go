@@ -0,0 +1,248 @@
+package workshop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AppID is the Steam app ID of Counter-Strike 2.
+const AppID = 730
+
+var (
+	ErrBadID = errors.New("workshop IDs must be numeric")
+	// ErrNeedsCollection is returned for more than one map without a
+	// collection, since srcds only downloads the map it starts with.
+	ErrNeedsCollection = errors.New("more than one workshop map needs a collection holding them")
+	// ErrUnavailable wraps failures of the metadata source.
+	ErrUnavailable = errors.New("workshop metadata unavailable")
+)
+
+// ItemError reports an item that doesn't pass Check.
+type ItemError struct {
+	ID     string
+	Reason string
+}
+
+func (e *ItemError) Error() string {
+	return "workshop item " + e.ID + " " + e.Reason
+}
+
+// Item is the metadata of one published workshop file.
+type Item struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Size       int64     `json:"size"`
+	PreviewURL string    `json:"previewUrl,omitempty"`
+	AppID      int       `json:"appId"`
+	Tags       []string  `json:"tags,omitempty"`
+	Updated    time.Time `json:"updated"`
+	// Children lists the items of a collection.
+	Children []string `json:"children,omitempty"`
+}
+
+// MetadataSource looks up workshop items. The Steam Web API is the real
+// source; MockSource stands in for it in tests and offline setups.
+type MetadataSource interface {
+	// Items returns the items among ids that exist, in the order of ids.
+	Items(ctx context.Context, ids []string) ([]Item, error)
+	// Collection returns the IDs of the items in a collection.
+	Collection(ctx context.Context, id string) ([]string, error)
+}
+
+// Config is the workshop content attached to a server. StartMap is the map
+// loaded on start; it defaults to the first of Maps. srcds only downloads
+// the start map and the collection, so any other map must be part of the
+// collection.
+type Config struct {
+	Maps       []string `json:"maps"`
+	Collection string   `json:"collection,omitempty"`
+	StartMap   string   `json:"startMap,omitempty"`
+}
+
+// Validate checks that every ID is numeric and that more than one map comes
+// with a collection.
+func (c Config) Validate() error {
+	ids := append([]string{c.Collection, c.StartMap}, c.Maps...)
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return ErrBadID
+		}
+	}
+	if c.Collection == "" && len(c.otherMaps()) > 0 {
+		return ErrNeedsCollection
+	}
+	return nil
+}
+
+// LaunchArgs returns the srcds arguments that make the server download and
+// host the configured content.
+func (c Config) LaunchArgs() []string {
+	var args []string
+	if c.Collection != "" {
+		args = append(args, "+host_workshop_collection", c.Collection)
+	}
+	if start := c.startMap(); start != "" {
+		args = append(args, "+host_workshop_map", start)
+	}
+	return args
+}
+
+func (c Config) startMap() string {
+	if c.StartMap == "" && len(c.Maps) > 0 {
+		return c.Maps[0]
+	}
+	return c.StartMap
+}
+
+// otherMaps returns the maps besides the start map, which srcds only gets
+// through the collection.
+func (c Config) otherMaps() []string {
+	start := c.startMap()
+	var others []string
+	for _, id := range c.Maps {
+		if id != start && !slices.Contains(others, id) {
+			others = append(others, id)
+		}
+	}
+	return others
+}
+
+// Store keeps the workshop config of every server as dir/<server>.json.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Get returns the config of server, which is empty if none was saved.
+func (s *Store) Get(server string) (Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg := Config{Maps: []string{}}
+	data, err := os.ReadFile(s.path(server))
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Maps == nil {
+		cfg.Maps = []string{}
+	}
+	return cfg, nil
+}
+
+func (s *Store) Put(server string, cfg Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(server) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(server))
+}
+
+func (s *Store) Remove(server string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(server))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) path(server string) string {
+	return filepath.Join(s.dir, filepath.Base(server)+".json")
+}
+
+// Check looks up the content of cfg, which must pass Validate, and returns
+// its items. Items that don't exist, aren't CS2 items or, besides the start
+// map, aren't part of the collection yield an *ItemError. Failures of the
+// source wrap ErrUnavailable, leaving cfg unchecked.
+func Check(ctx context.Context, source MetadataSource, cfg Config) ([]Item, error) {
+	var ids []string
+	for _, id := range append([]string{cfg.Collection, cfg.StartMap}, cfg.Maps...) {
+		if id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []Item{}, nil
+	}
+	items, err := source.Items(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	for _, id := range ids {
+		i := slices.IndexFunc(items, func(item Item) bool { return item.ID == id })
+		if i < 0 {
+			return nil, &ItemError{ID: id, Reason: "not found"}
+		}
+		if items[i].AppID != AppID {
+			return nil, &ItemError{ID: id, Reason: "is not a Counter-Strike 2 item"}
+		}
+	}
+
+	if others := cfg.otherMaps(); len(others) > 0 {
+		children, err := source.Collection(ctx, cfg.Collection)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		for _, id := range others {
+			if !slices.Contains(children, id) {
+				return nil, &ItemError{ID: id, Reason: "is not in collection " + cfg.Collection + ", so the server would not download it"}
+			}
+		}
+	}
+	return items, nil
+}
+
+// Attached returns the set of item IDs the config uses, expanding the
+// collection through source.
+func Attached(ctx context.Context, source MetadataSource, cfg Config) (map[string]bool, error) {
+	attached := map[string]bool{}
+	for _, id := range cfg.Maps {
+		attached[id] = true
+	}
+	if cfg.StartMap != "" {
+		attached[cfg.StartMap] = true
+	}
+	if cfg.Collection != "" {
+		children, err := source.Collection(ctx, cfg.Collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range children {
+			attached[id] = true
+		}
+	}
+	return attached, nil
+}
@@ -0,0 +1,154 @@
+package workshop
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+var testSource = NewMockSource(
+	Item{ID: "100", Title: "de_one", AppID: AppID},
+	Item{ID: "101", Title: "de_two", AppID: AppID},
+	Item{ID: "102", Title: "de_three", AppID: AppID},
+	Item{ID: "200", Title: "maps", AppID: AppID, Children: []string{"100", "101"}},
+	Item{ID: "300", Title: "other game", AppID: 440},
+)
+
+func TestLaunchArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{"empty", Config{}, nil},
+		{"one map", Config{Maps: []string{"100"}}, []string{"+host_workshop_map", "100"}},
+		{"collection", Config{Collection: "200"}, []string{"+host_workshop_collection", "200"}},
+		{
+			"collection starts with the first map",
+			Config{Maps: []string{"101", "100"}, Collection: "200"},
+			[]string{"+host_workshop_collection", "200", "+host_workshop_map", "101"},
+		},
+		{
+			"start map",
+			Config{Maps: []string{"100", "101"}, Collection: "200", StartMap: "101"},
+			[]string{"+host_workshop_collection", "200", "+host_workshop_map", "101"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.LaunchArgs(); !slices.Equal(got, tt.want) {
+				t.Errorf("LaunchArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want error
+	}{
+		{"empty", Config{}, nil},
+		{"one map", Config{Maps: []string{"100"}, StartMap: "100"}, nil},
+		{"same map twice", Config{Maps: []string{"100", "100"}}, nil},
+		{"maps with a collection", Config{Maps: []string{"100", "101"}, Collection: "200"}, nil},
+		{"maps without a collection", Config{Maps: []string{"100", "101"}}, ErrNeedsCollection},
+		{"start map in the maps", Config{Maps: []string{"100", "101"}, StartMap: "101", Collection: "200"}, nil},
+		{"start map besides a map", Config{Maps: []string{"100"}, StartMap: "101"}, ErrNeedsCollection},
+		{"bad map", Config{Maps: []string{"de_dust2"}}, ErrBadID},
+		{"bad collection", Config{Collection: "-1"}, ErrBadID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		// bad is the ID of the item Check must reject.
+		bad   string
+		items int
+	}{
+		{"empty", Config{}, "", 0},
+		{"one map", Config{Maps: []string{"102"}}, "", 1},
+		{"maps of the collection", Config{Maps: []string{"100", "101"}, Collection: "200"}, "", 3},
+		{"start map outside the collection", Config{Maps: []string{"100"}, Collection: "200", StartMap: "102"}, "", 3},
+		{"map outside the collection", Config{Maps: []string{"100", "102"}, Collection: "200"}, "102", 0},
+		{"missing map", Config{Maps: []string{"999"}}, "999", 0},
+		{"other game", Config{Maps: []string{"300"}}, "300", 0},
+		{"missing collection", Config{Collection: "998"}, "998", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := Check(context.Background(), testSource, tt.cfg)
+			if tt.bad != "" {
+				var itemErr *ItemError
+				if !errors.As(err, &itemErr) || itemErr.ID != tt.bad {
+					t.Fatalf("Check error = %v, want an *ItemError for %s", err, tt.bad)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if len(items) != tt.items {
+				t.Errorf("Check returned %d items, want %d", len(items), tt.items)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	// The collection exists as an item, but can't be expanded.
+	source := NewMockSource(
+		Item{ID: "100", AppID: AppID},
+		Item{ID: "101", AppID: AppID},
+		Item{ID: "200", AppID: AppID},
+	)
+	_, err := Check(context.Background(), source, Config{Maps: []string{"100", "101"}, Collection: "200"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Check error = %v, want ErrUnavailable", err)
+	}
+}
+
+// TestAttached covers what the downloads, delete and prune handlers treat
+// as in use.
+func TestAttached(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+		err  bool
+	}{
+		{"empty", Config{}, nil, false},
+		{"maps and start map", Config{Maps: []string{"100"}, StartMap: "102"}, []string{"100", "102"}, false},
+		{"collection", Config{Maps: []string{"102"}, Collection: "200"}, []string{"100", "101", "102"}, false},
+		{"collection that can't be expanded", Config{Maps: []string{"100"}, Collection: "998"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attached, err := Attached(context.Background(), testSource, tt.cfg)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Attached = %v, want an error", attached)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Attached: %v", err)
+			}
+			if got := slices.Sorted(maps.Keys(attached)); !slices.Equal(got, tt.want) {
+				t.Errorf("Attached = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}